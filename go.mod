@@ -5,6 +5,9 @@ go 1.14
 require (
 	github.com/aws/aws-lambda-go v1.19.1
 	github.com/aws/aws-sdk-go v1.35.7
+	github.com/emersion/go-imap v1.2.1
+	github.com/emersion/go-mbox v1.0.4
+	github.com/emersion/go-smtp v0.15.0
 	github.com/joho/godotenv v1.3.0
 	github.com/olekukonko/tablewriter v0.0.4 // indirect
 	github.com/onsi/ginkgo v1.12.0
@@ -0,0 +1,21 @@
+package main
+
+func init() {
+	parser := amazonParser()
+	parsers = append(parsers, parser)
+}
+
+// Amazon charges only show up as "AMZN Mktp US". The order confirmation is stored until
+// the poster finds the charge for it and can tell what was bought.
+func amazonParser() Parser {
+	parser := Parser{
+		name:             "Amazon",
+		validationString: "amazon.com/gp/css/order-details",
+		amountRegex:      "Order Total: \\$([\\d,]+\\.\\d+)",
+		dateRegex:        "Placed on \\w+, (\\w+ \\d+, \\d+)",
+		dateLayout:       "January 2, 2006",
+		itemRegex:        "(?m)^\\d+ of: (.*?)\\s+\\$([\\d,]+\\.\\d+)\\r?$",
+		kind:             "receipt",
+	}
+	return parser
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+)
+
+var _ = Describe("Parse Amazon emails", func() {
+
+	var (
+		emailbody           string
+		expectedTransaction Transaction
+	)
+
+	BeforeEach(func() {
+		dat, _ := ioutil.ReadFile("testemails/amazonEmail.txt")
+		emailbody = string(dat)
+		selectedParser = amazonParser()
+		expectedTransaction = Transaction{
+			MessageID: "",
+			Date:      "2020-10-18",
+			Amount:    52.00,
+			Merchant:  "Amazon",
+			Items: []Item{
+				{Title: "USB-C Cable, 6ft", Price: 12.99},
+				{Title: "The Go Programming Language (Paperback)", Price: 34.50},
+			},
+		}
+	})
+
+	Context("When given an email body to parse, ", func() {
+
+		It("parses the function correctly", func() {
+			transaction, err := parseEmail(emailbody)
+			Expect(err).To(BeNil())
+			Expect(transaction).To(Equal(expectedTransaction))
+		})
+
+	})
+
+})
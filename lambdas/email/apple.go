@@ -0,0 +1,20 @@
+package main
+
+func init() {
+	parser := appleParser()
+	parsers = append(parsers, parser)
+}
+
+// Apple receipts say which apps and subscriptions an "APPLE.COM/BILL" charge was for
+func appleParser() Parser {
+	parser := Parser{
+		name:             "Apple",
+		validationString: "Your receipt from Apple",
+		amountRegex:      "(?m)^TOTAL \\$([\\d,]+\\.\\d+)",
+		dateRegex:        "(?m)^DATE (\\w+ \\d+, \\d+)",
+		dateLayout:       "Jan 02, 2006",
+		itemRegex:        "(?m)^(.+?) {2,}\\$([\\d,]+\\.\\d+)\\r?$",
+		kind:             "receipt",
+	}
+	return parser
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/emersion/go-mbox"
+)
+
+// Transactions from the backfill command. The poster doesn't move their dates to today.
+const sourceBackfill = "backfill"
+
+// backfillFilter limits a backfill to the emails sent in a date range by some senders
+type backfillFilter struct {
+	Since   time.Time
+	Until   time.Time
+	Senders []string
+}
+
+func (f backfillFilter) matches(header mail.Header) bool {
+	if !f.Since.IsZero() || !f.Until.IsZero() {
+		date, err := header.Date()
+		if err != nil {
+			return false
+		}
+		if !f.Since.IsZero() && date.Before(f.Since) {
+			return false
+		}
+		// Until is a day, every email sent that day is included
+		if !f.Until.IsZero() && !date.Before(f.Until.AddDate(0, 0, 1)) {
+			return false
+		}
+	}
+
+	if len(f.Senders) == 0 {
+		return true
+	}
+	from := strings.ToLower(header.Get("From"))
+	for _, sender := range f.Senders {
+		if strings.Contains(from, strings.ToLower(sender)) {
+			return true
+		}
+	}
+	return false
+}
+
+type backfillStats struct {
+	Read      int
+	Filtered  int
+	NoParser  int
+	Failed    int
+	Duplicate int
+	Stored    int
+}
+
+func (s backfillStats) String() string {
+	return fmt.Sprintf("%d read, %d stored, %d duplicate, %d filtered out, %d without a parser, %d failed to parse",
+		s.Read, s.Stored, s.Duplicate, s.Filtered, s.NoParser, s.Failed)
+}
+
+// backfillLedger remembers the emails imported on this machine. The poster keeps posted backfill records
+// in the table for a year, so the conditional put catches emails imported elsewhere or before that.
+type backfillLedger struct {
+	path string
+	seen map[string]bool
+}
+
+func loadBackfillLedger(path string) (*backfillLedger, error) {
+	ledger := &backfillLedger{path: path, seen: map[string]bool{}}
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return ledger, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		ledger.seen[strings.TrimSpace(scanner.Text())] = true
+	}
+	return ledger, scanner.Err()
+}
+
+// add records an imported email
+func (l *backfillLedger) add(messageID string) error {
+	l.seen[messageID] = true
+	file, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = fmt.Fprintln(file, messageID)
+	return err
+}
+
+// backfillMessageID is stable across runs and exports. The same email exported twice gets the same ID.
+func backfillMessageID(header mail.Header, raw []byte) string {
+	return hashedMessageID(sourceBackfill, header, raw)
+}
+
+type backfill struct {
+	filter backfillFilter
+	ledger *backfillLedger
+	dryRun bool
+	stats  backfillStats
+}
+
+// importMessage runs one email through the parsers and saves it. Only errors that should stop the
+// backfill, like DynamoDB being unavailable, are returned.
+func (b *backfill) importMessage(raw []byte) (*Transaction, error) {
+	b.stats.Read++
+
+	message, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil || !b.filter.matches(message.Header) {
+		b.stats.Filtered++
+		return nil, nil
+	}
+
+	messageID := backfillMessageID(message.Header, raw)
+	if b.ledger.seen[messageID] {
+		b.stats.Duplicate++
+		return nil, nil
+	}
+
+	mailBody, err := decodeMail(bytes.NewReader(raw))
+	if err != nil {
+		b.stats.Failed++
+		return nil, nil
+	}
+
+	selectedParser = selectParser(mailBody)
+	if selectedParser == (Parser{}) {
+		// Exports are full of emails that aren't alerts
+		b.stats.NoParser++
+		return nil, nil
+	}
+
+	transaction, err := newTransaction(messageID, mailBody)
+	if err != nil {
+		log.Printf("%s parser failed on %q: %s", selectedParser.name, message.Header.Get("Subject"), err)
+		b.stats.Failed++
+		return nil, nil
+	}
+	transaction.Source = sourceBackfill
+
+	if !b.dryRun {
+		err = saveTransaction(transaction, table)
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			// Imported by an earlier run, on this machine or another
+			b.stats.Duplicate++
+			return nil, b.ledger.add(messageID)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	b.stats.Stored++
+	if b.dryRun {
+		// Dry runs read the ledger but don't add to it
+		b.ledger.seen[messageID] = true
+		return &transaction, nil
+	}
+	return &transaction, b.ledger.add(messageID)
+}
+
+// readMailbox calls fn with every email in an mbox file, or in the cur and new folders of a Maildir
+func readMailbox(path string, fn func(raw []byte) error) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return readMaildir(path, fn)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := mbox.NewReader(file)
+	for {
+		message, err := reader.NextMessage()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		raw, err := ioutil.ReadAll(message)
+		if err != nil {
+			return err
+		}
+		if err := fn(raw); err != nil {
+			return err
+		}
+	}
+}
+
+func readMaildir(path string, fn func(raw []byte) error) error {
+	var files []string
+	for _, folder := range []string{"cur", "new"} {
+		entries, err := ioutil.ReadDir(filepath.Join(path, folder))
+		if err != nil {
+			return fmt.Errorf("%s is not a Maildir: %v", path, err)
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				files = append(files, filepath.Join(path, folder, entry.Name()))
+			}
+		}
+	}
+	// Maildir names start with the delivery time
+	sort.Slice(files, func(i, j int) bool { return filepath.Base(files[i]) < filepath.Base(files[j]) })
+
+	for _, file := range files {
+		raw, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		if err := fn(raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runBackfill imports the alerts in an mbox file or Maildir. Every batch of stored transactions is
+// followed by a pause so the poster stays under YNAB's rate limit.
+func runBackfill(args []string) error {
+	flags := flag.NewFlagSet("backfill", flag.ContinueOnError)
+	sinceFlag := flags.String("since", "", "skip emails sent before this date (2006-01-02)")
+	untilFlag := flags.String("until", "", "skip emails sent after this date (2006-01-02)")
+	fromFlag := flags.String("from", "", "comma separated senders to import, matched against the From header")
+	batchSize := flags.Int("batch", 20, "transactions to store before pausing")
+	pause := flags.Duration("pause", 10*time.Minute, "pause between batches")
+	ledgerPath := flags.String("ledger", ".backfill-imported", "file listing the emails already imported")
+	dryRun := flags.Bool("dry-run", false, "print the transactions instead of storing them")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: email backfill [flags] <mbox file or Maildir>")
+	}
+
+	var filter backfillFilter
+	var err error
+	if *sinceFlag != "" {
+		if filter.Since, err = time.Parse("2006-01-02", *sinceFlag); err != nil {
+			return fmt.Errorf("invalid since date: %v", err)
+		}
+	}
+	if *untilFlag != "" {
+		if filter.Until, err = time.Parse("2006-01-02", *untilFlag); err != nil {
+			return fmt.Errorf("invalid until date: %v", err)
+		}
+	}
+	for _, sender := range strings.Split(*fromFlag, ",") {
+		if sender = strings.TrimSpace(sender); sender != "" {
+			filter.Senders = append(filter.Senders, sender)
+		}
+	}
+	if !*dryRun && table == "" {
+		return fmt.Errorf("missing dynamoDB table name")
+	}
+
+	ledger, err := loadBackfillLedger(*ledgerPath)
+	if err != nil {
+		return err
+	}
+
+	b := &backfill{filter: filter, ledger: ledger, dryRun: *dryRun}
+	inBatch := 0
+	err = readMailbox(flags.Arg(0), func(raw []byte) error {
+		transaction, err := b.importMessage(raw)
+		if b.stats.Read%500 == 0 {
+			log.Printf("Progress: %s", b.stats)
+		}
+		if err != nil || transaction == nil {
+			return err
+		}
+		if b.dryRun {
+			fmt.Printf("%s %s %.2f %s\n", transaction.Date, transaction.Parser, transaction.Amount, transaction.Merchant)
+			return nil
+		}
+
+		inBatch++
+		if inBatch == *batchSize {
+			log.Printf("Progress: %s. Pausing %s", b.stats, *pause)
+			time.Sleep(*pause)
+			inBatch = 0
+		}
+		return nil
+	})
+	log.Printf("Backfill finished: %s", b.stats)
+	return err
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Backfill", func() {
+
+	var (
+		dir     string
+		ledger  *backfillLedger
+		filler  *backfill
+		results []*Transaction
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "backfill")
+		Expect(err).To(BeNil())
+		ledger, err = loadBackfillLedger(filepath.Join(dir, "ledger"))
+		Expect(err).To(BeNil())
+
+		filler = &backfill{
+			filter: backfillFilter{Since: time.Date(2020, 10, 1, 0, 0, 0, 0, time.UTC), Senders: []string{"chase.com"}},
+			ledger: ledger,
+			dryRun: true,
+		}
+		results = nil
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	run := func(path string) {
+		err := readMailbox(path, func(raw []byte) error {
+			transaction, err := filler.importMessage(raw)
+			if transaction != nil {
+				results = append(results, transaction)
+			}
+			return err
+		})
+		Expect(err).To(BeNil())
+	}
+
+	It("imports the alerts in an mbox once, keeping their dates", func() {
+		run("testemails/backfill.mbox")
+
+		Expect(filler.stats).To(Equal(backfillStats{Read: 5, Stored: 1, Duplicate: 1, Filtered: 2, NoParser: 1}))
+		Expect(results).To(HaveLen(1))
+		Expect(results[0].Date).To(Equal("2020-10-20"))
+		Expect(results[0].Merchant).To(Equal("Corner Coffee"))
+		Expect(results[0].Source).To(Equal(sourceBackfill))
+	})
+
+	It("skips emails imported by an earlier run", func() {
+		run("testemails/backfill.mbox")
+		Expect(ledger.add(results[0].MessageID)).To(Succeed())
+
+		ledger, err := loadBackfillLedger(filepath.Join(dir, "ledger"))
+		Expect(err).To(BeNil())
+		filler = &backfill{filter: filler.filter, ledger: ledger, dryRun: true}
+		run("testemails/backfill.mbox")
+		Expect(filler.stats.Stored).To(BeZero())
+		Expect(filler.stats.Duplicate).To(Equal(2))
+	})
+
+	It("reads Maildirs", func() {
+		body, _ := ioutil.ReadFile("testemails/chaseDebitEmail.txt")
+		header := "From: Chase <no.reply.alerts@chase.com>\r\nDate: Tue, 20 Oct 2020 09:15:00 -0700\r\nMessage-ID: <debit-1@alerts.chase.com>\r\n\r\n"
+		for _, folder := range []string{"cur", "new", "tmp"} {
+			Expect(os.MkdirAll(filepath.Join(dir, "Maildir", folder), 0700)).To(Succeed())
+		}
+		Expect(ioutil.WriteFile(filepath.Join(dir, "Maildir", "new", "1603210500.1.host"), append([]byte(header), body...), 0600)).To(Succeed())
+
+		run(filepath.Join(dir, "Maildir"))
+		Expect(results).To(HaveLen(1))
+		Expect(results[0].Amount).To(BeNumerically("~", 45.67, 0.001))
+	})
+
+})
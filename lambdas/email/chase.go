@@ -15,6 +15,8 @@ func chaseParser() Parser {
 		merchantRegex:    "A charge of \\(\\$USD\\) \\d+\\.\\d+ at (.*) has been authorized on .* at",
 		dateRegex:        "A charge of \\(\\$USD\\) \\d+\\.\\d+ at .* has been authorized on (.*) at",
 		dateLayout:       "Jan 02, 2006",
+		timeRegex:        "has been authorized on .* at (\\d+:\\d+ [AP]M)",
+		currencyRegex:    "A charge of \\(\\$(\\w+)\\)",
 	}
 	return parser
 }
@@ -0,0 +1,84 @@
+package main
+
+// Chase checking accounts send separate alerts for debit card purchases, ACH debits,
+// direct deposits and Zelle. They identify the account by its number rather than a card.
+func init() {
+	parsers = append(parsers,
+		chaseDebitParser(),
+		chaseACHParser(),
+		chaseDepositParser(),
+		chaseZelleSentParser(),
+		chaseZelleReceivedParser(),
+	)
+}
+
+func chaseDebitParser() Parser {
+	parser := Parser{
+		name:             "Chase Debit",
+		validationString: "You made a debit card transaction of",
+		fourDigitRegex:   "\\(\\.\\.\\.(\\d+)\\)",
+		amountRegex:      "debit card transaction of \\$([\\d,]+\\.\\d+) with",
+		merchantRegex:    "(?m)^Merchant: (.*)$",
+		dateRegex:        "Made on: (\\w+ \\d+, \\d+)",
+		dateLayout:       "Jan 02, 2006",
+		timeRegex:        "Made on: .* at (\\d+:\\d+ [AP]M)",
+	}
+	return parser
+}
+
+func chaseACHParser() Parser {
+	parser := Parser{
+		name:             "Chase ACH",
+		validationString: "An ACH debit of",
+		fourDigitRegex:   "account ending in (\\d+)",
+		amountRegex:      "An ACH debit of \\$([\\d,]+\\.\\d+) to",
+		merchantRegex:    "An ACH debit of \\$[\\d,]+\\.\\d+ to (.*) was posted",
+		dateRegex:        "was posted to your account on (\\w+ \\d+, \\d+)",
+		dateLayout:       "Jan 02, 2006",
+	}
+	return parser
+}
+
+func chaseDepositParser() Parser {
+	parser := Parser{
+		name:             "Chase Deposit",
+		validationString: "A direct deposit of",
+		fourDigitRegex:   "account ending in (\\d+)",
+		amountRegex:      "A direct deposit of \\$([\\d,]+\\.\\d+) from",
+		merchantRegex:    "A direct deposit of \\$[\\d,]+\\.\\d+ from (.*) was posted",
+		dateRegex:        "was posted to your account on (\\w+ \\d+, \\d+)",
+		dateLayout:       "Jan 02, 2006",
+		kind:             "deposit",
+	}
+	return parser
+}
+
+// The person paid becomes the payee and the Zelle memo the YNAB memo
+func chaseZelleSentParser() Parser {
+	parser := Parser{
+		name:             "Chase Zelle",
+		validationString: "You sent money with Zelle",
+		fourDigitRegex:   "account ending in (\\d+)",
+		amountRegex:      "You sent \\$([\\d,]+\\.\\d+) to",
+		merchantRegex:    "You sent \\$[\\d,]+\\.\\d+ to (.*) with Zelle",
+		dateRegex:        "(?m)^Date: (\\w+ \\d+, \\d+)",
+		dateLayout:       "Jan 02, 2006",
+		memoRegex:        "(?m)^Memo: (.*)$",
+	}
+	return parser
+}
+
+func chaseZelleReceivedParser() Parser {
+	parser := Parser{
+		name:             "Chase Zelle",
+		validationString: "sent you money with Zelle",
+		fourDigitRegex:   "account ending in (\\d+)",
+		amountRegex:      "You received \\$([\\d,]+\\.\\d+) from",
+		merchantRegex:    "You received \\$[\\d,]+\\.\\d+ from (.*) with Zelle",
+		dateRegex:        "(?m)^Date: (\\w+ \\d+, \\d+)",
+		dateLayout:       "Jan 02, 2006",
+		memoRegex:        "(?m)^Memo: (.*)$",
+		kind:             "deposit",
+	}
+	return parser
+}
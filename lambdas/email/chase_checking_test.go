@@ -0,0 +1,68 @@
+package main
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+)
+
+var _ = Describe("Parse Chase checking emails", func() {
+
+	parse := func(file string, parser Parser) Transaction {
+		dat, _ := ioutil.ReadFile("testemails/" + file)
+		selectedParser = parser
+		transaction, err := parseEmail(string(dat))
+		Expect(err).To(BeNil())
+		return transaction
+	}
+
+	Context("When given an email body to parse, ", func() {
+
+		It("parses debit card transactions", func() {
+			Expect(parse("chaseDebitEmail.txt", chaseDebitParser())).To(Equal(Transaction{
+				LastDigits: 4567,
+				Date:       "2020-10-20",
+				Amount:     45.67,
+				Merchant:   "Corner Coffee",
+				Time:       "9:15 AM",
+			}))
+		})
+
+		It("parses ACH debits", func() {
+			Expect(parse("chaseACHEmail.txt", chaseACHParser())).To(Equal(Transaction{
+				LastDigits: 4567,
+				Date:       "2020-10-20",
+				Amount:     120.00,
+				Merchant:   "PG&E WEB ONLINE",
+			}))
+		})
+
+		It("parses direct deposits", func() {
+			Expect(parse("chaseDepositEmail.txt", chaseDepositParser())).To(Equal(Transaction{
+				LastDigits: 4567,
+				Date:       "2020-10-16",
+				Amount:     2345.67,
+				Merchant:   "ACME CORP PAYROLL",
+			}))
+		})
+
+		It("parses Zelle payments with their memo", func() {
+			Expect(parse("chaseZelleSentEmail.txt", chaseZelleSentParser())).To(Equal(Transaction{
+				LastDigits: 4567,
+				Date:       "2020-10-19",
+				Amount:     25.00,
+				Merchant:   "John Smith",
+				Memo:       "Concert tickets",
+			}))
+			Expect(parse("chaseZelleReceivedEmail.txt", chaseZelleReceivedParser())).To(Equal(Transaction{
+				LastDigits: 4567,
+				Date:       "2020-10-19",
+				Amount:     40.00,
+				Merchant:   "Jane Doe",
+				Memo:       "Dinner at Luigi's",
+			}))
+		})
+
+	})
+
+})
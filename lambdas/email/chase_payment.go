@@ -0,0 +1,20 @@
+package main
+
+func init() {
+	parser := chasePaymentParser()
+	parsers = append(parsers, parser)
+}
+
+// Payment alerts also mention www.chase.com, so this has to be registered after the Chase parser
+func chasePaymentParser() Parser {
+	parser := Parser{
+		name:             "Chase Payment",
+		validationString: "Your payment of",
+		fourDigitRegex:   "account ending in (\\d+)",
+		amountRegex:      "Your payment of \\$([\\d,]+\\.\\d+) has been received",
+		dateRegex:        "has been received on (\\w+ \\d+, \\d+)",
+		dateLayout:       "Jan 02, 2006",
+		kind:             "payment",
+	}
+	return parser
+}
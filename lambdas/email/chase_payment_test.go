@@ -0,0 +1,50 @@
+package main
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"strings"
+)
+
+var _ = Describe("Parse Chase payment emails", func() {
+
+	var (
+		emailbody           string
+		expectedTransaction Transaction
+	)
+
+	BeforeEach(func() {
+		dat, _ := ioutil.ReadFile("testemails/chasePaymentEmail.txt")
+		emailbody = string(dat)
+		selectedParser = chasePaymentParser()
+		expectedTransaction = Transaction{
+			MessageID:  "",
+			LastDigits: 1234,
+			Date:       "2020-10-16",
+			Amount:     1500.00,
+			Merchant:   "Chase Payment",
+		}
+	})
+
+	Context("When given an email body to parse, ", func() {
+
+		It("parses the function correctly", func() {
+			transaction, err := parseEmail(emailbody)
+			Expect(err).To(BeNil())
+			Expect(transaction).To(Equal(expectedTransaction))
+		})
+
+		It("is picked over the Chase charge parser", func() {
+			var matched Parser
+			for _, parser := range parsers {
+				if strings.Contains(emailbody, parser.validationString) {
+					matched = parser
+				}
+			}
+			Expect(matched.name).To(Equal("Chase Payment"))
+		})
+
+	})
+
+})
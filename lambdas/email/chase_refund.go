@@ -0,0 +1,22 @@
+package main
+
+func init() {
+	parser := chaseRefundParser()
+	parsers = append(parsers, parser)
+}
+
+// Refund alerts also mention www.chase.com, so this has to be registered after the Chase parser
+func chaseRefundParser() Parser {
+	parser := Parser{
+		name:             "Chase Refund",
+		validationString: "A refund of ($USD)",
+		fourDigitRegex:   "account ending in (\\d+)",
+		amountRegex:      "A refund of \\(\\$USD\\) ([\\d,]+\\.\\d+) from .* has been credited on",
+		merchantRegex:    "A refund of \\(\\$USD\\) [\\d,]+\\.\\d+ from (.*) has been credited on",
+		dateRegex:        "has been credited on (\\w+ \\d+, \\d+)",
+		dateLayout:       "Jan 02, 2006",
+		timeRegex:        "has been credited on .* at (\\d+:\\d+ [AP]M)",
+		kind:             "refund",
+	}
+	return parser
+}
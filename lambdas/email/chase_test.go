@@ -25,6 +25,8 @@ var _ = Describe("Parse Chase emails", func() {
 			Date:       "2020-10-15",
 			Amount:     109.00,
 			Merchant:   "Test Mer\\chant.com",
+			Time:       "11:27 AM",
+			Currency:   "USD",
 		}
 		s3messageid = "5u8qddo35demvf0klm0647mg2bprkpcaqucgkd01"
 		s3expectedTransaction = Transaction{
@@ -16,6 +16,7 @@ func citiParser() Parser {
 		merchantRegex:  "(?m)Merchant[\\r\\n\\v]+(.*)[\\r\\n\\v]+Date",
 		dateRegex:      "(?m)Date[\\r\\n\\v]+(\\d+\\/\\d+\\/\\d+)[\\r\\n\\v]+Time",
 		dateLayout:     "01/02/2006",
+		timeRegex:      "(?m)Time[\\r\\n\\v]+(\\d+:\\d+.*)$",
 	}
 	return parser
 }
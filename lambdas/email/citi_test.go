@@ -5,6 +5,7 @@ import (
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"io/ioutil"
+	"os"
 	"time"
 )
 
@@ -74,11 +75,46 @@ var _ = Describe("Parse Citi emails", func() {
 
 	})
 
-	Context("When downloading a mail from S3, ", func() {
+	Context("When reading a mail from the mail store, ", func() {
+
+		var (
+			dir   string
+			saved []Transaction
+		)
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "mail")
+			Expect(err).To(BeNil())
+			mailSource = localMailSource{dir: dir}
+			dat, _ := ioutil.ReadFile("testemails/citiEmail.eml")
+			Expect(mailSource.Store(s3messageid, dat)).To(Succeed())
+
+			saved = nil
+			saveTransaction = func(transaction Transaction, tableName string) error {
+				saved = append(saved, transaction)
+				return nil
+			}
+		})
+
+		AfterEach(func() {
+			saveTransaction = saveToDynamoDB
+			mailSource = nil
+			os.RemoveAll(dir)
+		})
 
 		It("parses the function correctly", func() {
 			err := HandleLambdaEvent(request)
 			Expect(err).To(BeNil())
+			Expect(saved).To(Equal([]Transaction{{
+				MessageID:  s3messageid,
+				LastDigits: 2345,
+				Date:       "2020-10-14",
+				Amount:     12.34,
+				Merchant:   "I AM A LARGE #MERCHANT",
+				Time:       "12:03 PM ET",
+				Parser:     "Citi",
+			}}))
 		})
 	})
 
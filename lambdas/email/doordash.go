@@ -0,0 +1,22 @@
+package main
+
+func init() {
+	parser := doorDashParser()
+	parsers = append(parsers, parser)
+}
+
+// DoorDash receipts add the restaurant, what was ordered and the tip to the "DOORDASH*" charge
+func doorDashParser() Parser {
+	parser := Parser{
+		name:             "DoorDash",
+		validationString: "Dasher Tip", // every DoorDash receipt has the line, even at $0.00
+		amountRegex:      "(?m)^Total \\$([\\d,]+\\.\\d+)",
+		dateRegex:        "Order placed: (\\w+ \\d+, \\d+)",
+		dateLayout:       "Jan 02, 2006",
+		itemRegex:        "(?m)^\\d+x (.*?)\\s+\\$([\\d,]+\\.\\d+)\\r?$",
+		tipRegex:         "(?m)^Dasher Tip \\$([\\d,]+\\.\\d+)",
+		detailsRegex:     "(?m)^Order Confirmation for .* from (.*)$",
+		kind:             "receipt",
+	}
+	return parser
+}
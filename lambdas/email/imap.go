@@ -0,0 +1,381 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+)
+
+// imapConfig is read from the IMAP_* variables
+type imapConfig struct {
+	Addr            string
+	Username        string
+	Password        string
+	Folder          string
+	ProcessedFolder string
+	FailedFolder    string
+	// Plain connections are only for a server on the same machine
+	TLS bool
+	// How long to wait for IDLE to report new mail before checking anyway
+	PollInterval time.Duration
+	// Remembers the last imported UID so a restart doesn't import everything again
+	StateFile string
+}
+
+func imapConfigFromEnv() (imapConfig, error) {
+	config := imapConfig{
+		Addr:            os.Getenv("IMAP_ADDR"),
+		Username:        os.Getenv("IMAP_USERNAME"),
+		Password:        os.Getenv("IMAP_PASSWORD"),
+		Folder:          getEnvDefault("IMAP_FOLDER", "INBOX"),
+		ProcessedFolder: getEnvDefault("IMAP_PROCESSED_FOLDER", "Processed"),
+		FailedFolder:    getEnvDefault("IMAP_FAILED_FOLDER", "Failed"),
+		TLS:             os.Getenv("IMAP_TLS") != "false",
+		PollInterval:    5 * time.Minute,
+		StateFile:       getEnvDefault("IMAP_STATE_FILE", ".imap-state.json"),
+	}
+	if config.Addr == "" || config.Username == "" {
+		return config, fmt.Errorf("missing IMAP_ADDR or IMAP_USERNAME")
+	}
+	if interval := os.Getenv("IMAP_POLL_INTERVAL"); interval != "" {
+		duration, err := time.ParseDuration(interval)
+		if err != nil {
+			return config, fmt.Errorf("invalid IMAP_POLL_INTERVAL: %v", err)
+		}
+		config.PollInterval = duration
+	}
+	return config, nil
+}
+
+func getEnvDefault(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// imapState is saved after every message. UIDs are only meaningful for the same UIDVALIDITY.
+type imapState struct {
+	UIDValidity uint32 `json:"uidValidity"`
+	LastUID     uint32 `json:"lastUID"`
+}
+
+func loadIMAPState(path string) (imapState, error) {
+	var state imapState
+	contents, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+	err = json.Unmarshal(contents, &state)
+	return state, err
+}
+
+func (s imapState) save(path string) error {
+	contents, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, contents, 0600)
+}
+
+type imapImporter struct {
+	config imapConfig
+	client *client.Client
+	state  imapState
+	// Signalled when the server reports new mail, read by wait
+	changed chan struct{}
+}
+
+func connectIMAP(config imapConfig) (*imapImporter, error) {
+	var c *client.Client
+	var err error
+	if config.TLS {
+		c, err = client.DialTLS(config.Addr, nil)
+	} else {
+		c, err = client.Dial(config.Addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	importer := &imapImporter{config: config, client: c, changed: make(chan struct{}, 1)}
+	updates := make(chan client.Update, 10)
+	c.Updates = updates
+	go importer.watch(updates)
+
+	if err := c.Login(config.Username, config.Password); err != nil {
+		c.Logout()
+		return nil, err
+	}
+	for _, folder := range []string{config.ProcessedFolder, config.FailedFolder} {
+		if err := importer.ensureFolder(folder); err != nil {
+			c.Logout()
+			return nil, err
+		}
+	}
+
+	importer.state, err = loadIMAPState(config.StateFile)
+	if err != nil {
+		c.Logout()
+		return nil, fmt.Errorf("could not read %s: %v", config.StateFile, err)
+	}
+	return importer, nil
+}
+
+// watch reads every update the server sends. The client blocks when its Updates channel is full,
+// and moving messages while importing sends an EXPUNGE for each one.
+func (i *imapImporter) watch(updates chan client.Update) {
+	for {
+		select {
+		case update := <-updates:
+			if _, ok := update.(*client.MailboxUpdate); !ok {
+				continue
+			}
+			select {
+			case i.changed <- struct{}{}:
+			default:
+				// wait hasn't picked up the last change yet
+			}
+		case <-i.client.LoggedOut():
+			return
+		}
+	}
+}
+
+func (i *imapImporter) ensureFolder(name string) error {
+	mailboxes := make(chan *imap.MailboxInfo, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- i.client.List("", name, mailboxes)
+	}()
+	exists := false
+	for range mailboxes {
+		exists = true
+	}
+	if err := <-done; err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+	return i.client.Create(name)
+}
+
+// imapMessage is a fetched message, kept until the fetch is done because no other command can run during it
+type imapMessage struct {
+	uid      uint32
+	raw      []byte
+	envelope *imap.Envelope
+	// Set when the server didn't return the message
+	err error
+}
+
+// importNew runs the messages that arrived since the last imported UID through the parsers and moves
+// each one to the processed or failed folder. A retryable failure stops the batch, so that message and
+// the ones after it are tried again on the next round. A message the server can't return would fail
+// every round, so it goes to the failed folder.
+func (i *imapImporter) importNew() ([]recordResult, error) {
+	status, err := i.client.Select(i.config.Folder, false)
+	if err != nil {
+		return nil, err
+	}
+	if status.UidValidity != i.state.UIDValidity {
+		// The folder was recreated, old UIDs mean nothing
+		i.state = imapState{UIDValidity: status.UidValidity}
+	}
+	if status.Messages == 0 {
+		return nil, nil
+	}
+
+	criteria := imap.NewSearchCriteria()
+	criteria.Uid = new(imap.SeqSet)
+	criteria.Uid.AddRange(i.state.LastUID+1, 0)
+	uids, err := i.client.UidSearch(criteria)
+	if err != nil {
+		return nil, err
+	}
+
+	seqSet := new(imap.SeqSet)
+	for _, uid := range uids {
+		// "n:*" always includes the last message, even when it was already imported
+		if uid > i.state.LastUID {
+			seqSet.AddNum(uid)
+		}
+	}
+	if seqSet.Empty() {
+		return nil, nil
+	}
+
+	messages, err := i.fetch(seqSet)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []recordResult
+	for _, message := range messages {
+		var result recordResult
+		if message.err != nil {
+			result = failed(i.messageID(message.uid), "Could not fetch mail", message.err)
+			result.Retryable = false
+		} else {
+			result = i.importMessage(message)
+		}
+		results = append(results, result)
+		if result.Retryable {
+			break
+		}
+
+		folder := i.config.ProcessedFolder
+		if result.Outcome == outcomeQuarantined || result.Outcome == outcomeFailed {
+			folder = i.config.FailedFolder
+		}
+		if err := i.move(message.uid, folder); err != nil {
+			return results, err
+		}
+
+		i.state.LastUID = message.uid
+		if err := i.state.save(i.config.StateFile); err != nil {
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+func (i *imapImporter) fetch(seqSet *imap.SeqSet) ([]imapMessage, error) {
+	section := &imap.BodySectionName{Peek: true}
+	items := []imap.FetchItem{imap.FetchUid, imap.FetchEnvelope, section.FetchItem()}
+
+	fetched := make(chan *imap.Message, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- i.client.UidFetch(seqSet, items, fetched)
+	}()
+
+	var messages []imapMessage
+	for msg := range fetched {
+		message := imapMessage{uid: msg.Uid, envelope: msg.Envelope}
+		if body := msg.GetBody(section); body == nil {
+			message.err = fmt.Errorf("server returned no body for UID %d", msg.Uid)
+		} else {
+			message.raw, message.err = ioutil.ReadAll(body)
+		}
+		messages = append(messages, message)
+	}
+	if err := <-done; err != nil {
+		return nil, err
+	}
+	// The last imported UID only works as a marker when messages are imported in order
+	sort.Slice(messages, func(a, b int) bool { return messages[a].uid < messages[b].uid })
+	return messages, nil
+}
+
+// A message imported again after a crash, before the state was saved, gets the same ID
+func (i *imapImporter) messageID(uid uint32) string {
+	return fmt.Sprintf("imap-%d-%d", i.state.UIDValidity, uid)
+}
+
+// importMessage processes the message like an email from SES
+func (i *imapImporter) importMessage(message imapMessage) recordResult {
+	sesMail := events.SimpleEmailMessage{MessageID: i.messageID(message.uid)}
+	if message.envelope != nil {
+		sesMail.CommonHeaders.Subject = message.envelope.Subject
+		for _, address := range message.envelope.From {
+			sesMail.CommonHeaders.From = append(sesMail.CommonHeaders.From, address.Address())
+		}
+	}
+
+	return importMail(sesMail, message.raw)
+}
+
+// move falls back to copy, flag and expunge for servers that advertise MOVE without supporting it
+func (i *imapImporter) move(uid uint32, folder string) error {
+	seqSet := new(imap.SeqSet)
+	seqSet.AddNum(uid)
+	if err := i.client.UidMove(seqSet, folder); err == nil {
+		return nil
+	}
+
+	if err := i.client.UidCopy(seqSet, folder); err != nil {
+		return err
+	}
+	flags := []interface{}{imap.DeletedFlag}
+	if err := i.client.UidStore(seqSet, imap.FormatFlagsOp(imap.AddFlags, true), flags, nil); err != nil {
+		return err
+	}
+	return i.client.Expunge(nil)
+}
+
+// wait returns when IDLE reports a change in the folder or after the poll interval
+func (i *imapImporter) wait() error {
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- i.client.Idle(stop, &client.IdleOptions{PollInterval: i.config.PollInterval})
+	}()
+
+	timeout := time.NewTimer(i.config.PollInterval)
+	defer timeout.Stop()
+	select {
+	case <-i.changed:
+	case <-timeout.C:
+	case err := <-done:
+		return err
+	}
+	close(stop)
+	return <-done
+}
+
+// runIMAP imports from an IMAP folder until the connection fails
+func runIMAP(args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("usage: email imap (configured with IMAP_* variables)")
+	}
+	config, err := imapConfigFromEnv()
+	if err != nil {
+		return err
+	}
+	if table == "" {
+		return fmt.Errorf("missing dynamoDB table name")
+	}
+	daemon = true
+	mailSource, err = newMailSource()
+	if err != nil {
+		return err
+	}
+
+	importer, err := connectIMAP(config)
+	if err != nil {
+		return err
+	}
+	defer importer.client.Logout()
+	log.Printf("Importing new mail in %s from %s", config.Folder, config.Addr)
+
+	for {
+		results, err := importer.importNew()
+		summary, retryErr := summarizeResults(results)
+		if summary != "" {
+			notifyError(summary, nil)
+		}
+		if retryErr != nil {
+			log.Print(retryErr)
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := importer.wait(); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend/memory"
+	"github.com/emersion/go-imap/server"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("IMAP ingestion", func() {
+
+	var (
+		dir      string
+		backend  *memory.Backend
+		listener net.Listener
+		config   imapConfig
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "imap")
+		Expect(err).To(BeNil())
+		mailSource = localMailSource{dir: dir}
+
+		// The memory backend has one message in INBOX, with UID 6, that no parser matches
+		backend = memory.New()
+		imapServer := server.New(backend)
+		imapServer.AllowInsecureAuth = true
+		listener, err = net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).To(BeNil())
+		go imapServer.Serve(listener)
+
+		config = imapConfig{
+			Addr:            listener.Addr().String(),
+			Username:        "username",
+			Password:        "password",
+			Folder:          "INBOX",
+			ProcessedFolder: "Processed",
+			FailedFolder:    "Failed",
+			PollInterval:    time.Second,
+			StateFile:       filepath.Join(dir, "state.json"),
+		}
+	})
+
+	AfterEach(func() {
+		listener.Close()
+		mailSource = nil
+		os.RemoveAll(dir)
+	})
+
+	messages := func(importer *imapImporter, folder string) uint32 {
+		status, err := importer.client.Status(folder, []imap.StatusItem{imap.StatusMessages})
+		Expect(err).To(BeNil())
+		return status.Messages
+	}
+
+	It("moves messages it can't import to the failed folder", func() {
+		importer, err := connectIMAP(config)
+		Expect(err).To(BeNil())
+		defer importer.client.Logout()
+
+		results, err := importer.importNew()
+		Expect(err).To(BeNil())
+		Expect(results).To(HaveLen(1))
+		Expect(results[0].Outcome).To(Equal(outcomeQuarantined))
+		Expect(results[0].MessageID).To(Equal("imap-1-6"))
+
+		Expect(messages(importer, "INBOX")).To(BeZero())
+		Expect(messages(importer, "Failed")).To(Equal(uint32(1)))
+		Expect(filepath.Join(dir, "quarantine", "imap-1-6.json")).To(BeAnExistingFile())
+	})
+
+	It("keeps reading server updates while importing many messages", func() {
+		user, err := backend.Login(nil, "username", "password")
+		Expect(err).To(BeNil())
+		inbox, err := user.GetMailbox("INBOX")
+		Expect(err).To(BeNil())
+		dat, _ := ioutil.ReadFile("testemails/spamEmail.txt")
+		for n := 0; n < 14; n++ {
+			Expect(inbox.CreateMessage(nil, time.Now(), bytes.NewBuffer(dat))).To(Succeed())
+		}
+
+		importer, err := connectIMAP(config)
+		Expect(err).To(BeNil())
+		defer importer.client.Logout()
+
+		// Every move sends an update. Without something reading them the client blocks after ten.
+		done := make(chan []recordResult)
+		go func() {
+			defer GinkgoRecover()
+			results, err := importer.importNew()
+			Expect(err).To(BeNil())
+			done <- results
+		}()
+		Eventually(done, 10*time.Second).Should(Receive(HaveLen(15)))
+		Expect(messages(importer, "Failed")).To(Equal(uint32(15)))
+	})
+
+	It("deletes the copy of a message imported again after a crash", func() {
+		saved := map[string]bool{}
+		saveTransaction = func(transaction Transaction, tableName string) error {
+			if saved[transaction.MessageID] {
+				return awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "exists", nil)
+			}
+			saved[transaction.MessageID] = true
+			return nil
+		}
+		defer func() { saveTransaction = saveToDynamoDB }()
+
+		user, err := backend.Login(nil, "username", "password")
+		Expect(err).To(BeNil())
+		inbox, err := user.GetMailbox("INBOX")
+		Expect(err).To(BeNil())
+		dat, _ := ioutil.ReadFile("testemails/citiEmail.eml")
+		Expect(inbox.CreateMessage(nil, time.Now(), bytes.NewBuffer(dat))).To(Succeed())
+
+		Expect(imapState{UIDValidity: 1}.save(config.StateFile)).To(Succeed())
+		importer, err := connectIMAP(config)
+		Expect(err).To(BeNil())
+		defer importer.client.Logout()
+
+		// Imported, then the importer stopped before moving it or saving the state
+		Expect(importer.importMessage(imapMessage{uid: 7, raw: dat}).Outcome).To(Equal(outcomeStored))
+		// The poster posted it and deleted the copy
+		Expect(os.Remove(filepath.Join(dir, "imap-1-7"))).To(Succeed())
+
+		results, err := importer.importNew()
+		Expect(err).To(BeNil())
+		Expect(results).To(HaveLen(2))
+		Expect(results[1].Outcome).To(Equal(outcomeDuplicate))
+		Expect(filepath.Join(dir, "imap-1-7")).NotTo(BeAnExistingFile())
+		Expect(messages(importer, "Processed")).To(Equal(uint32(1)))
+	})
+
+	It("doesn't import a message twice after a restart", func() {
+		Expect(imapState{UIDValidity: 1, LastUID: 6}.save(config.StateFile)).To(Succeed())
+
+		importer, err := connectIMAP(config)
+		Expect(err).To(BeNil())
+		defer importer.client.Logout()
+
+		results, err := importer.importNew()
+		Expect(err).To(BeNil())
+		Expect(results).To(BeEmpty())
+		Expect(messages(importer, "INBOX")).To(Equal(uint32(1)))
+	})
+
+	It("starts over when the folder's UIDVALIDITY changes", func() {
+		Expect(imapState{UIDValidity: 2, LastUID: 6}.save(config.StateFile)).To(Succeed())
+
+		importer, err := connectIMAP(config)
+		Expect(err).To(BeNil())
+		defer importer.client.Logout()
+
+		results, err := importer.importNew()
+		Expect(err).To(BeNil())
+		Expect(results).To(HaveLen(1))
+	})
+
+})
@@ -0,0 +1,21 @@
+package main
+
+func init() {
+	parser := lyftParser()
+	parsers = append(parsers, parser)
+}
+
+// Lyft receipts add the destination and tip to the "LYFT *RIDE" charge
+func lyftParser() Parser {
+	parser := Parser{
+		name:             "Lyft",
+		validationString: "Thanks for riding with Lyft",
+		amountRegex:      "Total charged \\$([\\d,]+\\.\\d+)",
+		dateRegex:        "(?m)^(\\w+ \\d+, \\d+)\\r?$",
+		dateLayout:       "January 2, 2006",
+		tipRegex:         "(?m)^Tip \\$([\\d,]+\\.\\d+)",
+		detailsRegex:     "(?m)^Drop-off (.*)$",
+		kind:             "receipt",
+	}
+	return parser
+}
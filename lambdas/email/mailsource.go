@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// MailSource keeps the raw emails until they are imported. Keys are message IDs, or a prefix
+// followed by the message ID for archived emails.
+type MailSource interface {
+	// Fetch returns the raw email, or errMailNotFound
+	Fetch(messageID string) (io.ReadCloser, error)
+	// Store saves a raw email or a file that belongs with one, like a quarantine sidecar
+	Store(key string, contents []byte) error
+	// Archive moves an email to another key
+	Archive(messageID, key string) error
+	Delete(messageID string) error
+}
+
+// errMailNotFound usually means the email was already imported and deleted by the poster
+var errMailNotFound = errors.New("mail not found")
+
+// hashedMessageID names an email by its Message-ID header, or its contents when it has none, so the
+// same email gets the same name when it is delivered or exported again
+func hashedMessageID(prefix string, header mail.Header, raw []byte) string {
+	hash := sha1.New()
+	if id := header.Get("Message-ID"); id != "" {
+		hash.Write([]byte(id))
+	} else {
+		hash.Write(raw)
+	}
+	return prefix + "-" + hex.EncodeToString(hash.Sum(nil))[:20]
+}
+
+// newMailSource picks the source from MAIL_SOURCE: "s3" (the default) reads the bucket SES writes to,
+// "local" reads the files in MAIL_DIR
+func newMailSource() (MailSource, error) {
+	switch os.Getenv("MAIL_SOURCE") {
+	case "", "s3":
+		bucket := os.Getenv("BUCKET_NAME")
+		if bucket == "" {
+			return nil, fmt.Errorf("missing bucket name")
+		}
+		return newS3MailSource(bucket, "us-west-2")
+	case "local":
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			return nil, fmt.Errorf("missing mail directory")
+		}
+		return localMailSource{dir: dir}, nil
+	default:
+		return nil, fmt.Errorf("unknown mail source %q", os.Getenv("MAIL_SOURCE"))
+	}
+}
+
+type s3MailSource struct {
+	client *s3.S3
+	bucket string
+}
+
+func newS3MailSource(bucket, region string) (*s3MailSource, error) {
+	sess, err := session.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	return &s3MailSource{client: s3.New(sess, aws.NewConfig().WithRegion(region)), bucket: bucket}, nil
+}
+
+func (s *s3MailSource) Fetch(messageID string) (io.ReadCloser, error) {
+	obj, err := s.client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(messageID),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+			return nil, errMailNotFound
+		}
+		log.Printf("S3 GetObject failed: %s", err)
+		return nil, err
+	}
+	return obj.Body, nil
+}
+
+func (s *s3MailSource) Store(key string, contents []byte) error {
+	_, err := s.client.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+		Body:   bytes.NewReader(contents),
+	})
+	if err != nil {
+		log.Printf("S3 PutObject failed: %s", err)
+		return err
+	}
+	return nil
+}
+
+func (s *s3MailSource) Archive(messageID, key string) error {
+	_, err := s.client.CopyObject(&s3.CopyObjectInput{
+		Bucket:     aws.String(s.bucket),
+		CopySource: aws.String(s.bucket + "/" + messageID),
+		Key:        aws.String(key),
+	})
+	if err != nil {
+		log.Printf("S3 CopyObject failed: %s", err)
+		return err
+	}
+	return s.Delete(messageID)
+}
+
+func (s *s3MailSource) Delete(messageID string) error {
+	_, err := s.client.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(messageID),
+	})
+	if err != nil {
+		log.Printf("S3 DeleteObject failed: %s", err)
+		return err
+	}
+	return nil
+}
+
+// localMailSource keeps each email in a file named after its message ID
+type localMailSource struct {
+	dir string
+}
+
+func (l localMailSource) path(key string) (string, error) {
+	path := filepath.Join(l.dir, filepath.FromSlash(key))
+	// Join cleans the path, so a key can only leave the directory through leading ".."s
+	rel, err := filepath.Rel(filepath.Clean(l.dir), path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid mail key %q", key)
+	}
+	return path, nil
+}
+
+func (l localMailSource) Fetch(messageID string) (io.ReadCloser, error) {
+	path, err := l.path(messageID)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, errMailNotFound
+	}
+	return file, err
+}
+
+func (l localMailSource) Store(key string, contents []byte) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, contents, 0600)
+}
+
+func (l localMailSource) Archive(messageID, key string) error {
+	from, err := l.path(messageID)
+	if err != nil {
+		return err
+	}
+	to, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(to), 0700); err != nil {
+		return err
+	}
+	return os.Rename(from, to)
+}
+
+func (l localMailSource) Delete(messageID string) error {
+	path, err := l.path(messageID)
+	if err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// importMail saves an email received by IMAP or SMTP to the mail store, unless an earlier attempt
+// left it there, and processes it. Both can deliver the same email again, after a crash or a retry.
+func importMail(sesMail events.SimpleEmailMessage, raw []byte) recordResult {
+	stored := false
+	existing, err := mailSource.Fetch(sesMail.MessageID)
+	switch err {
+	case nil:
+		existing.Close()
+	case errMailNotFound:
+		if err := mailSource.Store(sesMail.MessageID, raw); err != nil {
+			return failed(sesMail.MessageID, "Could not save mail", err)
+		}
+		stored = true
+	default:
+		return failed(sesMail.MessageID, "Error checking the mail store", err)
+	}
+
+	result := processRecord(sesMail)
+	if stored && result.Outcome == outcomeDuplicate {
+		// Already posted, and the poster deleted the copy from the first delivery
+		if err := mailSource.Delete(sesMail.MessageID); err != nil {
+			log.Printf("Could not delete redelivered mail %s: %v", sesMail.MessageID, err)
+		}
+	}
+	return result
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/aws/aws-lambda-go/events"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Local mail source", func() {
+
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "mail")
+		Expect(err).To(BeNil())
+		mailSource = localMailSource{dir: dir}
+
+		dat, _ := ioutil.ReadFile("testemails/spamEmail.txt")
+		Expect(mailSource.Store("spam", dat)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		mailSource = nil
+		os.RemoveAll(dir)
+	})
+
+	It("fetches, archives and deletes emails by message ID", func() {
+		raw, err := mailSource.Fetch("spam")
+		Expect(err).To(BeNil())
+		raw.Close()
+
+		Expect(mailSource.Archive("spam", "archive/spam")).To(Succeed())
+		_, err = mailSource.Fetch("spam")
+		Expect(err).To(Equal(errMailNotFound))
+
+		Expect(mailSource.Delete("archive/spam")).To(Succeed())
+		Expect(filepath.Join(dir, "archive", "spam")).NotTo(BeAnExistingFile())
+	})
+
+	It("refuses keys outside the directory", func() {
+		_, err := mailSource.Fetch("../spam")
+		Expect(err).To(MatchError(`invalid mail key "../spam"`))
+	})
+
+	It("reads the current directory with MAIL_DIR=.", func() {
+		wd, _ := os.Getwd()
+		Expect(os.Chdir(dir)).To(Succeed())
+		defer os.Chdir(wd)
+		os.Setenv("MAIL_SOURCE", "local")
+		os.Setenv("MAIL_DIR", ".")
+		defer os.Unsetenv("MAIL_SOURCE")
+		defer os.Unsetenv("MAIL_DIR")
+
+		source, err := newMailSource()
+		Expect(err).To(BeNil())
+		raw, err := source.Fetch("spam")
+		Expect(err).To(BeNil())
+		raw.Close()
+		_, err = source.Fetch("../spam")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("quarantines emails without a parser offline", func() {
+		sesMail := events.SimpleEmailMessage{MessageID: "spam", Source: "alerts@chase.com"}
+
+		result := processRecord(sesMail)
+		Expect(result.Outcome).To(Equal(outcomeQuarantined))
+		Expect(filepath.Join(dir, "quarantine", "spam")).To(BeAnExistingFile())
+		Expect(filepath.Join(dir, "quarantine", "spam.json")).To(BeAnExistingFile())
+
+		result = processRecord(sesMail)
+		Expect(result.Outcome).To(Equal(outcomeDuplicate))
+	})
+
+})
@@ -21,18 +21,21 @@ import (
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
-	"github.com/aws/aws-sdk-go/service/s3"
 )
 
 var (
 	parsers        []Parser
 	selectedParser Parser
-	bucket         string
 	table          string
-	s3Client       *s3.S3
+	mailSource     MailSource
+	// Replaced in tests to run the whole pipeline offline
+	saveTransaction = saveToDynamoDB
+	// Set by the long running imap, smtp and sms-server modes, a Slack outage mustn't stop them
+	daemon bool
 )
 
 type Transaction struct {
@@ -41,8 +44,32 @@ type Transaction struct {
 	Date       string
 	Amount     float32
 	Merchant   string
+	Parser     string
+	Time       string
+	Currency   string
+	Type       string
+	Memo       string
+	Wallet     string
+	// Receipts only. The poster merges them with the card charge.
+	Items     []Item  `json:",omitempty"`
+	Tip       float32 `json:",omitempty"`
+	Details   string  `json:",omitempty"`
+	ExpiresAt int64   `json:",omitempty"`
+	// "backfill" for old emails imported in bulk. The poster keeps their dates.
+	Source string `json:",omitempty"`
+	// The alert is for the final amount of an earlier authorization
+	Settled bool `json:",omitempty"`
 }
 
+// Item is one line of a receipt
+type Item struct {
+	Title string
+	Price float32
+}
+
+// Receipts waiting for their card charge are removed by DynamoDB after this
+const receiptTTL = 30 * 24 * time.Hour
+
 type Parser struct {
 	name             string
 	validationString string
@@ -51,6 +78,24 @@ type Parser struct {
 	merchantRegex    string
 	dateRegex        string
 	dateLayout       string
+	// Optional, not every bank includes these
+	timeRegex     string
+	currencyRegex string
+	memoRegex     string
+	// Empty for purchases and withdrawals, "payment" for card payments, "refund", "deposit" or "receipt"
+	kind string
+	// Receipts can list items with a title and a price, in that order
+	itemRegex    string
+	tipRegex     string
+	detailsRegex string
+	// PayPal and Venmo can pay from their own balance instead of a card. When balanceString
+	// is in the email the transaction is posted to the wallet's account. Without a
+	// balanceString every transaction goes to the wallet.
+	wallet        string
+	balanceString string
+	// Alerts for the final amount of an earlier authorization, e.g. once a restaurant tip
+	// posts, contain settledString. The poster updates the authorization instead of posting.
+	settledString string
 }
 
 type SlackRequestBody struct {
@@ -67,8 +112,14 @@ func notifyError(message string, err error) {
 	}
 
 	log.Print(errorString)
+	if slackURL == "" {
+		// Self-hosted modes can run without Slack
+		return
+	}
 	serr := SendSlackNotification(slackURL, errorString)
-	if serr != nil {
+	if serr != nil && daemon {
+		log.Printf("Could not send Slack notification: %v", serr)
+	} else if serr != nil {
 		log.Fatal(serr)
 	}
 }
@@ -101,103 +152,136 @@ func SendSlackNotification(webhookUrl string, msg string) error {
 
 func init() {
 	// check if variable is already setup
-	bucket = os.Getenv("BUCKET_NAME")
-	if bucket == "" {
+	if os.Getenv("TABLE_NAME") == "" {
 		// Probably running locally. Load variables from .env file instead.
+		// Not needed to parse a local file, so main checks the variables it uses.
 		err := godotenv.Load(".env")
-
 		if err != nil {
-			log.Fatal("Error loading .env file")
+			log.Printf("Not loading .env file: %s", err)
 		}
-		bucket = os.Getenv("BUCKET_NAME")
 	}
 
 	table = os.Getenv("TABLE_NAME")
-
-	err := createS3Client("us-west-2")
-	if err != nil {
-		log.Fatalf("Error creating S3 client: " + err.Error())
-	}
-
 }
 
 func main() {
-
-	if bucket == "" {
-		log.Fatal("Missing bucket name")
+	if len(os.Args) > 1 {
+		var err error
+		switch os.Args[1] {
+		case "parse":
+			err = printParsedMail(os.Args[2:])
+		case "imap":
+			err = runIMAP(os.Args[2:])
+		case "smtp":
+			err = runSMTP(os.Args[2:])
+		case "backfill":
+			err = runBackfill(os.Args[2:])
+		case "sms-server":
+			err = runSMSServer(os.Args[2:])
+		default:
+			err = fmt.Errorf("unknown command %q", os.Args[1])
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
 
 	if table == "" {
 		log.Fatal("Missing dynamoDB table name")
 	}
 
+	// The SMS webhook is deployed as its own function and doesn't read mail
+	if os.Getenv("LAMBDA_MODE") == "sms" {
+		lambda.Start(HandleSMSRequest)
+		return
+	}
+
+	var err error
+	mailSource, err = newMailSource()
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	lambda.Start(HandleLambdaEvent)
 }
 
 func HandleLambdaEvent(event events.SimpleEmailEvent) error {
-
+	var results []recordResult
 	for _, sesMail := range event.Records {
+		results = append(results, processRecord(sesMail.SES.Mail))
+	}
 
-		//Retrieve message from S3
-		mailBody, err := retrieveMail(sesMail.SES.Mail.MessageID)
-
-		if err != nil {
-			notifyError("Error retrieving mail", err)
-			return err
-		}
-
-		for _, parser := range parsers {
-			if strings.Contains(mailBody, parser.validationString) {
-				selectedParser = parser
-			}
-		}
+	summary, err := summarizeResults(results)
+	if summary != "" {
+		notifyError(summary, nil)
+	}
+	return err
+}
 
-		if selectedParser == (Parser{}) {
-			notifyError("Email does not match a parser. Mailbody below.", fmt.Errorf(mailBody))
-			return fmt.Errorf("email does not match a parser")
-		}
+// processRecord imports one email. Records are independent, one failing doesn't stop the rest.
+func processRecord(sesMail events.SimpleEmailMessage) recordResult {
+	messageID := sesMail.MessageID
 
-		transaction, err := parseEmail(mailBody)
-		if err != nil {
-			notifyError("Could not parse mail", err)
-			return err
-		}
+	raw, err := mailSource.Fetch(messageID)
+	if err == errMailNotFound {
+		// Already imported and deleted by the poster, or already quarantined
+		return recordResult{MessageID: messageID, Outcome: outcomeDuplicate, Detail: "not in the mail store"}
+	}
+	if err != nil {
+		return failed(messageID, "Error retrieving mail", err)
+	}
 
-		transaction.MessageID = sesMail.SES.Mail.MessageID
-		err = saveToDynamoDB(transaction, table)
-		if err != nil {
-			notifyError("Could not save record to DynamoDB", err)
-			return err
-		}
+	mailBody, err := decodeMail(raw)
+	raw.Close()
+	if err != nil {
+		return quarantined(sesMail, reasonUnreadable, err, "")
+	}
 
-		// Delete the message - moved deletion to dynamo poster
-		// If dynamo runs into an error, I want to see original email
+	selectedParser = selectParser(mailBody)
+	if selectedParser == (Parser{}) {
+		return quarantined(sesMail, reasonNoParser, nil, mailBody)
+	}
 
+	transaction, err := newTransaction(messageID, mailBody)
+	if err != nil {
+		return quarantined(sesMail, reasonParseFailed, err, mailBody)
 	}
-	return nil
-}
 
-func createS3Client(region string) error {
-	sess, err := session.NewSession()
+	err = saveTransaction(transaction, table)
 	if err != nil {
-		return err
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			// SES or Lambda retried an email that was already saved
+			return recordResult{MessageID: messageID, Outcome: outcomeDuplicate, Detail: "already saved"}
+		}
+		return failed(messageID, "Could not save record to DynamoDB", err)
 	}
-	s3Client = s3.New(sess, aws.NewConfig().WithRegion(region))
-	return nil
+
+	// Delete the message - moved deletion to dynamo poster
+	// If dynamo runs into an error, I want to see original email
+	return recordResult{MessageID: messageID, Outcome: outcomeStored, Detail: selectedParser.name}
 }
 
-func retrieveMail(messageid string) (string, error) {
-	//Retrieve message from S3
-	s3Mail, err := getFromS3(messageid)
-	if err != nil {
-		log.Printf("get message from S3 failed: %s", err)
-		return "", err
+// quarantined moves the email to the quarantine. If that fails the record is retried.
+func quarantined(sesMail events.SimpleEmailMessage, reason string, err error, mailBody string) recordResult {
+	record := newQuarantineRecord(sesMail, reason, err, mailBody)
+	key, qerr := quarantineMail(record)
+	if qerr != nil {
+		return failed(sesMail.MessageID, fmt.Sprintf("Could not quarantine email (%s)", reason), qerr)
 	}
+	return recordResult{MessageID: sesMail.MessageID, Outcome: outcomeQuarantined, Detail: quarantineSummary(record, key)}
+}
 
-	defer s3Mail.Close()
+// failed records are retried. Emails that will never import are quarantined instead.
+func failed(messageID, message string, err error) recordResult {
+	log.Printf("%s %s: %s", message, messageID, err)
+	return recordResult{MessageID: messageID, Outcome: outcomeFailed, Detail: fmt.Sprintf("%s: %s", message, err), Retryable: true}
+}
 
+// decodeMail turns a raw email into the plain text body the parsers read
+func decodeMail(raw io.Reader) (string, error) {
 	// parse the original message
-	parsedMail, err := mail.ReadMessage(s3Mail)
+	parsedMail, err := mail.ReadMessage(raw)
 	if err != nil {
 		log.Printf("ReadMessage failed: %s", err)
 		return "", err
@@ -223,41 +307,50 @@ func retrieveMail(messageid string) (string, error) {
 
 }
 
-func getFromS3(key string) (io.ReadCloser, error) {
-
-	obj, err := s3Client.GetObject(&s3.GetObjectInput{
-		Bucket: aws.String(bucket),
-		Key:    aws.String(key),
-	})
-	if err != nil {
-		log.Printf("S3 GetObject failed: %s", err)
-		return nil, err
+// selectParser returns the last parser whose validation string is in the email, or an empty Parser.
+// A warm lambda still has the parser of the previous email, so it is always reset.
+func selectParser(mailBody string) Parser {
+	selected := Parser{}
+	for _, parser := range parsers {
+		if strings.Contains(mailBody, parser.validationString) {
+			selected = parser
+		}
 	}
-	return obj.Body, nil
+	return selected
 }
 
-func deleteS3Object(key string) error {
-
-	_, err := s3Client.DeleteObject(&s3.DeleteObjectInput{
-		Bucket: aws.String(bucket),
-		Key:    aws.String(key),
-	})
+// newTransaction parses the email with selectedParser into the record saved to DynamoDB
+func newTransaction(messageID, mailBody string) (Transaction, error) {
+	transaction, err := parseEmail(mailBody)
 	if err != nil {
-		log.Printf("S3 DeleteObject failed: %s", err)
-		return err
+		return Transaction{}, err
 	}
-	return nil
+
+	transaction.MessageID = messageID
+	transaction.Parser = selectedParser.name
+	transaction.Type = selectedParser.kind
+	if transaction.Type == "receipt" {
+		transaction.ExpiresAt = time.Now().Add(receiptTTL).Unix()
+	}
+	return transaction, nil
 }
 
 func parseEmail(contents string) (Transaction, error) {
-	lastDigitsString, err := getLastDigits(contents)
-	if err != nil {
-		return Transaction{}, err
-	}
+	var lastDigits int
+	var wallet string
+	if selectedParser.wallet != "" && strings.Contains(contents, selectedParser.balanceString) {
+		wallet = selectedParser.wallet
+	} else if selectedParser.fourDigitRegex != "" {
+		// Receipts don't always say which card pays
+		lastDigitsString, err := getLastDigits(contents)
+		if err != nil {
+			return Transaction{}, err
+		}
 
-	lastDigits, err := strconv.Atoi(lastDigitsString)
-	if err != nil {
-		return Transaction{}, err
+		lastDigits, err = strconv.Atoi(lastDigitsString)
+		if err != nil {
+			return Transaction{}, err
+		}
 	}
 
 	date, err := getDate(contents)
@@ -270,14 +363,19 @@ func parseEmail(contents string) (Transaction, error) {
 		return Transaction{}, err
 	}
 
-	amount, err := strconv.ParseFloat(amountString, 32)
+	// Payments are often over $1,000
+	amount, err := strconv.ParseFloat(strings.Replace(amountString, ",", "", -1), 32)
 	if err != nil {
 		return Transaction{}, err
 	}
 
-	payee, err := getMerchant(contents)
-	if err != nil {
-		return Transaction{}, err
+	// Payments have no merchant. The parser name is still useful in memos.
+	payee := selectedParser.name
+	if selectedParser.merchantRegex != "" {
+		payee, err = getMerchant(contents)
+		if err != nil {
+			return Transaction{}, err
+		}
 	}
 
 	transaction := Transaction{
@@ -285,10 +383,51 @@ func parseEmail(contents string) (Transaction, error) {
 		Date:       date,
 		Amount:     float32(amount),
 		Merchant:   payee,
+		Time:       getOptional(contents, "time", selectedParser.timeRegex),
+		Currency:   getOptional(contents, "currency", selectedParser.currencyRegex),
+		Memo:       getOptional(contents, "memo", selectedParser.memoRegex),
+		Wallet:     wallet,
+		Details:    getOptional(contents, "details", selectedParser.detailsRegex),
+		Settled:    selectedParser.settledString != "" && strings.Contains(contents, selectedParser.settledString),
+	}
+
+	if tip := getOptional(contents, "tip", selectedParser.tipRegex); tip != "" {
+		value, err := strconv.ParseFloat(strings.Replace(tip, ",", "", -1), 32)
+		if err != nil {
+			return Transaction{}, err
+		}
+		transaction.Tip = float32(value)
+	}
+
+	if selectedParser.itemRegex != "" {
+		transaction.Items, err = getItems(contents)
+		if err != nil {
+			return Transaction{}, err
+		}
 	}
 	return transaction, nil
 }
 
+func getItems(contents string) ([]Item, error) {
+	re, err := regexp.Compile(selectedParser.itemRegex)
+	if err != nil {
+		return nil, fmt.Errorf("error compiling items regex")
+	}
+
+	var items []Item
+	for _, match := range re.FindAllStringSubmatch(contents, -1) {
+		price, err := strconv.ParseFloat(strings.Replace(match[2], ",", "", -1), 32)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, Item{Title: strings.TrimSpace(match[1]), Price: float32(price)})
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("could not parse items regex")
+	}
+	return items, nil
+}
+
 func extractInformation(contents, title, regex string) (string, error) {
 	re, err := regexp.Compile(regex)
 	if err != nil {
@@ -341,7 +480,24 @@ func getMerchant(contents string) (string, error) {
 	return extractInformation(contents, "merchant", selectedParser.merchantRegex)
 }
 
+// Optional details are left empty when the parser doesn't define them or they can't be found
+func getOptional(contents, title, regex string) string {
+	if regex == "" {
+		return ""
+	}
+	value, err := extractInformation(contents, title, regex)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(value)
+}
+
 func getDate(contents string) (string, error) {
+	if selectedParser.dateRegex == "" {
+		// SMS alerts are sent as the transaction happens and often leave the date out. Like the
+		// poster, go back 6 hours from UTC so evening alerts in the US keep their day.
+		return parseDate(time.Now().Add(time.Hour * -6))
+	}
 	dateString, _ := extractInformation(contents, "date", selectedParser.dateRegex)
 	date, _ := time.Parse(selectedParser.dateLayout, dateString)
 	return parseDate(date)
@@ -372,7 +528,8 @@ func saveToDynamoDB(transaction Transaction, tableName string) error {
 	input := &dynamodb.PutItemInput{
 		Item:      av,
 		TableName: aws.String(tableName),
-		//ConditionExpression:      aws.String("attribute_not_exists(messageID)"),
+		// A retried email must not be posted twice
+		ConditionExpression: aws.String("attribute_not_exists(messageID)"),
 	}
 
 	_, err = svc.PutItem(input)
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+type outcome string
+
+const (
+	outcomeStored      outcome = "stored"
+	outcomeQuarantined outcome = "quarantined"
+	outcomeDuplicate   outcome = "duplicate"
+	outcomeFailed      outcome = "failed"
+)
+
+// recordResult is what happened to one SES record
+type recordResult struct {
+	MessageID string
+	Outcome   outcome
+	Detail    string
+	// Failures that may succeed on another try, e.g. S3 or DynamoDB being unavailable
+	Retryable bool
+}
+
+// summarizeResults builds the one notification sent per invocation, empty when there is nothing
+// to report, and an error when SES should retry the invocation. Records already stored are
+// recognized as duplicates on the retry.
+func summarizeResults(results []recordResult) (string, error) {
+	counts := map[outcome]int{}
+	retryable := 0
+	var details []string
+	for _, result := range results {
+		counts[result.Outcome]++
+		if result.Retryable {
+			retryable++
+		}
+		if result.Outcome == outcomeQuarantined || result.Outcome == outcomeFailed {
+			details = append(details, fmt.Sprintf("%s %s: %s", result.Outcome, result.MessageID, result.Detail))
+		}
+	}
+
+	var err error
+	if retryable > 0 {
+		err = fmt.Errorf("%d of %d emails failed and will be retried", retryable, len(results))
+	}
+
+	if len(details) == 0 {
+		return "", err
+	}
+
+	summary := fmt.Sprintf("%d stored, %d quarantined, %d duplicate, %d failed\n%s",
+		counts[outcomeStored], counts[outcomeQuarantined], counts[outcomeDuplicate], counts[outcomeFailed],
+		strings.Join(details, "\n"))
+	return summary, err
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Invocation results", func() {
+
+	It("stays quiet when every email was stored or already saved", func() {
+		summary, err := summarizeResults([]recordResult{
+			{MessageID: "a", Outcome: outcomeStored},
+			{MessageID: "b", Outcome: outcomeDuplicate},
+		})
+		Expect(err).To(BeNil())
+		Expect(summary).To(BeEmpty())
+	})
+
+	It("reports quarantined emails without retrying", func() {
+		summary, err := summarizeResults([]recordResult{
+			{MessageID: "a", Outcome: outcomeStored},
+			{MessageID: "b", Outcome: outcomeQuarantined, Detail: "Email from x quarantined"},
+		})
+		Expect(err).To(BeNil())
+		Expect(summary).To(HavePrefix("1 stored, 1 quarantined, 0 duplicate, 0 failed"))
+		Expect(summary).To(ContainSubstring("quarantined b: Email from x quarantined"))
+	})
+
+	It("asks for a retry only for retryable failures", func() {
+		summary, err := summarizeResults([]recordResult{
+			{MessageID: "a", Outcome: outcomeStored},
+			{MessageID: "b", Outcome: outcomeFailed, Detail: "Could not save record to DynamoDB: throttled", Retryable: true},
+		})
+		Expect(err).To(MatchError("1 of 2 emails failed and will be retried"))
+		Expect(summary).To(ContainSubstring("failed b: Could not save record to DynamoDB: throttled"))
+	})
+
+})
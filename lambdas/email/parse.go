@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// parsedMail is what `email parse` prints
+type parsedMail struct {
+	Parser     string                 `json:"parser"`
+	Candidates []string               `json:"candidateParsers,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+	Fields     *Transaction           `json:"fields,omitempty"`
+	Item       map[string]interface{} `json:"dynamoDBItem,omitempty"`
+}
+
+// printParsedMail runs a local .eml or text file through the same steps as HandleLambdaEvent,
+// without S3 or DynamoDB, and prints the result as JSON
+func printParsedMail(args []string) error {
+	flags := flag.NewFlagSet("parse", flag.ContinueOnError)
+	raw := flags.Bool("raw", false, "the file is the email body, skip MIME decoding")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: email parse [-raw] <file>")
+	}
+
+	result, err := parseMailFile(flags.Arg(0), *raw)
+	if err != nil {
+		return err
+	}
+
+	output, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(output))
+
+	if result.Error != "" {
+		os.Exit(1)
+	}
+	return nil
+}
+
+func parseMailFile(path string, raw bool) (parsedMail, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return parsedMail{}, err
+	}
+
+	// Saved bodies like the ones in testemails have no headers and aren't MIME encoded
+	mailBody := string(contents)
+	if !raw {
+		decoded, err := decodeMail(bytes.NewReader(contents))
+		if err == nil {
+			mailBody = decoded
+		}
+	}
+
+	selectedParser = selectParser(mailBody)
+	if selectedParser == (Parser{}) {
+		return parsedMail{Candidates: candidateParsers(mailBody), Error: reasonNoParser}, nil
+	}
+
+	result := parsedMail{Parser: selectedParser.name}
+	transaction, err := newTransaction(filepath.Base(path), mailBody)
+	if err != nil {
+		result.Error = fmt.Sprintf("%s: %s", reasonParseFailed, err)
+		return result, nil
+	}
+	result.Fields = &transaction
+
+	av, err := dynamodbattribute.MarshalMap(transaction)
+	if err != nil {
+		return parsedMail{}, err
+	}
+	err = dynamodbattribute.UnmarshalMap(av, &result.Item)
+	if err != nil {
+		return parsedMail{}, err
+	}
+	return result, nil
+}
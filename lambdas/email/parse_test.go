@@ -0,0 +1,39 @@
+package main
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Parse local files", func() {
+
+	It("runs a saved body through parser selection and extraction", func() {
+		result, err := parseMailFile("testemails/chaseDebitEmail.txt", false)
+		Expect(err).To(BeNil())
+		Expect(result.Parser).To(Equal("Chase Debit"))
+		Expect(result.Error).To(BeEmpty())
+		Expect(result.Fields.MessageID).To(Equal("chaseDebitEmail.txt"))
+		Expect(result.Fields.Amount).To(BeNumerically("~", 45.67, 0.001))
+		Expect(result.Item).To(HaveKeyWithValue("messageID", "chaseDebitEmail.txt"))
+		Expect(result.Item).To(HaveKeyWithValue("Merchant", "Corner Coffee"))
+	})
+
+	It("decodes .eml files", func() {
+		result, err := parseMailFile("testemails/citiEmail.eml", false)
+		Expect(err).To(BeNil())
+		Expect(result.Parser).To(Equal("Citi"))
+		Expect(result.Error).To(BeEmpty())
+		Expect(result.Fields.LastDigits).To(Equal(2345))
+		Expect(result.Fields.Amount).To(BeNumerically("~", 12.34, 0.001))
+		Expect(result.Fields.Merchant).To(Equal("I AM A LARGE #MERCHANT"))
+	})
+
+	It("reports emails no parser matches", func() {
+		result, err := parseMailFile("testemails/spamEmail.txt", false)
+		Expect(err).To(BeNil())
+		Expect(result.Parser).To(BeEmpty())
+		Expect(result.Error).To(Equal(reasonNoParser))
+		Expect(result.Fields).To(BeNil())
+	})
+
+})
@@ -0,0 +1,24 @@
+package main
+
+func init() {
+	parser := payPalParser()
+	parsers = append(parsers, parser)
+}
+
+// PayPal receipts name the real merchant, which the card alert only shows as "PAYPAL *..."
+func payPalParser() Parser {
+	parser := Parser{
+		name:             "PayPal",
+		validationString: "You sent a payment of",
+		fourDigitRegex:   "(?m)^Paid with[\\r\\n\\v]+.* x-(\\d+)",
+		amountRegex:      "You sent a payment of \\$([\\d,]+\\.\\d+) \\w+ to",
+		merchantRegex:    "(?m)You sent a payment of \\$[\\d,]+\\.\\d+ \\w+ to (.*)$",
+		dateRegex:        "Transaction date: (\\w+ \\d+, \\d+)",
+		dateLayout:       "Jan 02, 2006",
+		currencyRegex:    "You sent a payment of \\$[\\d,]+\\.\\d+ (\\w+) to",
+		memoRegex:        "(?m)^Note to .*?: (.*)$",
+		wallet:           "PayPal",
+		balanceString:    "PayPal balance",
+	}
+	return parser
+}
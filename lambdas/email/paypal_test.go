@@ -0,0 +1,51 @@
+package main
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"strings"
+)
+
+var _ = Describe("Parse PayPal emails", func() {
+
+	var (
+		emailbody           string
+		expectedTransaction Transaction
+	)
+
+	BeforeEach(func() {
+		dat, _ := ioutil.ReadFile("testemails/payPalEmail.txt")
+		emailbody = string(dat)
+		selectedParser = payPalParser()
+		expectedTransaction = Transaction{
+			MessageID:  "",
+			LastDigits: 1234,
+			Date:       "2020-10-18",
+			Amount:     59.99,
+			Merchant:   "Valve Corporation",
+			Currency:   "USD",
+			Memo:       "Half-Life: Alyx",
+		}
+	})
+
+	Context("When given an email body to parse, ", func() {
+
+		It("parses the function correctly", func() {
+			transaction, err := parseEmail(emailbody)
+			Expect(err).To(BeNil())
+			Expect(transaction).To(Equal(expectedTransaction))
+		})
+
+		It("uses the PayPal account when paid from the balance", func() {
+			emailbody = strings.Replace(emailbody, "Visa x-1234", "PayPal balance", 1)
+			expectedTransaction.LastDigits = 0
+			expectedTransaction.Wallet = "PayPal"
+			transaction, err := parseEmail(emailbody)
+			Expect(err).To(BeNil())
+			Expect(transaction).To(Equal(expectedTransaction))
+		})
+
+	})
+
+})
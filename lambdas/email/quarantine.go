@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Emails that no parser matches, or that fail to parse, are moved here with a JSON sidecar
+// describing why, so the body never has to leave the mail store
+const defaultQuarantinePrefix = "quarantine/"
+
+const (
+	reasonNoParser    = "no parser matched"
+	reasonParseFailed = "parse failed"
+	reasonUnreadable  = "could not decode"
+)
+
+// quarantineRecord is the sidecar saved next to a quarantined email
+type quarantineRecord struct {
+	MessageID     string   `json:"messageID"`
+	Reason        string   `json:"reason"`
+	Error         string   `json:"error,omitempty"`
+	Sender        string   `json:"sender"`
+	Subject       string   `json:"subject"`
+	Candidates    []string `json:"candidateParsers"`
+	QuarantinedAt string   `json:"quarantinedAt"`
+}
+
+func quarantinePrefix() string {
+	prefix := os.Getenv("QUARANTINE_PREFIX")
+	if prefix == "" {
+		return defaultQuarantinePrefix
+	}
+	return prefix
+}
+
+func newQuarantineRecord(sesMail events.SimpleEmailMessage, reason string, err error, mailBody string) quarantineRecord {
+	record := quarantineRecord{
+		MessageID:     sesMail.MessageID,
+		Reason:        reason,
+		Sender:        sesMail.Source,
+		Subject:       sesMail.CommonHeaders.Subject,
+		QuarantinedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+	if len(sesMail.CommonHeaders.From) > 0 {
+		record.Sender = strings.Join(sesMail.CommonHeaders.From, ", ")
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	if reason == reasonParseFailed {
+		record.Candidates = []string{selectedParser.name}
+	} else {
+		record.Candidates = candidateParsers(mailBody)
+	}
+	return record
+}
+
+// candidateParsers lists the parsers whose full name appears in the email as words, e.g. "Chase"
+// but not "Chase Zelle" for a Chase statement. A parser whose validation string changed usually
+// still names its bank.
+func candidateParsers(mailBody string) []string {
+	candidates := []string{}
+	seen := map[string]bool{}
+	for _, parser := range parsers {
+		if seen[parser.name] {
+			continue
+		}
+		name := regexp.MustCompile(`(?i)\b` + regexp.QuoteMeta(parser.name) + `\b`)
+		if name.MatchString(mailBody) {
+			candidates = append(candidates, parser.name)
+			seen[parser.name] = true
+		}
+	}
+	return candidates
+}
+
+// quarantineMail moves the email to the quarantine prefix of the mail source, writes the sidecar and returns the new key
+func quarantineMail(record quarantineRecord) (string, error) {
+	key := quarantinePrefix() + record.MessageID
+
+	sidecar, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	// The sidecar goes first, a retry still finds the email if this fails
+	err = mailSource.Store(key+".json", sidecar)
+	if err != nil {
+		return "", err
+	}
+
+	err = mailSource.Archive(record.MessageID, key)
+	if err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// quarantineSummary is all that is sent to Slack. The body and sidecar stay in S3.
+func quarantineSummary(record quarantineRecord, key string) string {
+	summary := fmt.Sprintf("Email from %s quarantined (%s) as %s", record.Sender, record.Reason, key)
+	if len(record.Candidates) > 0 {
+		summary += fmt.Sprintf(". Candidate parsers: %s", strings.Join(record.Candidates, ", "))
+	}
+	return summary
+}
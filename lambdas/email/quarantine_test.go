@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-lambda-go/events"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Quarantine", func() {
+
+	var sesMail events.SimpleEmailMessage
+
+	BeforeEach(func() {
+		sesMail = events.SimpleEmailMessage{
+			MessageID: "abc123",
+			Source:    "bounce@chase.com",
+			CommonHeaders: events.SimpleEmailCommonHeaders{
+				From:    []string{"Chase <no.reply.alerts@chase.com>"},
+				Subject: "Your statement is ready",
+			},
+		}
+	})
+
+	It("suggests parsers for the bank named in the email", func() {
+		record := newQuarantineRecord(sesMail, reasonNoParser, nil, "Your Chase statement is ready. 100% on time!")
+		Expect(record.Sender).To(Equal("Chase <no.reply.alerts@chase.com>"))
+		Expect(record.Subject).To(Equal("Your statement is ready"))
+		Expect(record.Candidates).To(Equal([]string{"Chase"}))
+	})
+
+	It("doesn't suggest parsers for part of their name", func() {
+		record := newQuarantineRecord(sesMail, reasonNoParser, nil, "Your bank statement is ready. Thanks for dining at Applebee's.")
+		Expect(record.Candidates).To(BeEmpty())
+	})
+
+	It("names the parser that failed", func() {
+		selectedParser = citiParser()
+		record := newQuarantineRecord(sesMail, reasonParseFailed, fmt.Errorf("could not parse amount regex"), "")
+		Expect(record.Candidates).To(Equal([]string{"Citi"}))
+		Expect(record.Error).To(Equal("could not parse amount regex"))
+
+		sidecar, err := json.Marshal(record)
+		Expect(err).To(BeNil())
+		Expect(string(sidecar)).To(ContainSubstring(`"reason":"parse failed"`))
+	})
+
+	It("leaves the email body out of the notification", func() {
+		record := newQuarantineRecord(sesMail, reasonNoParser, nil, "Account 1234 balance 100%")
+		summary := quarantineSummary(record, "quarantine/abc123")
+		Expect(summary).To(ContainSubstring("quarantine/abc123"))
+		Expect(summary).NotTo(ContainSubstring("balance"))
+	})
+
+})
@@ -0,0 +1,81 @@
+package main
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+)
+
+var _ = Describe("Parse receipt emails", func() {
+
+	parse := func(file string, parser Parser) Transaction {
+		dat, _ := ioutil.ReadFile("testemails/" + file)
+		selectedParser = parser
+		transaction, err := parseEmail(string(dat))
+		Expect(err).To(BeNil())
+		return transaction
+	}
+
+	Context("When given an email body to parse, ", func() {
+
+		It("parses Uber trips with the tip and destination", func() {
+			Expect(parse("uberEmail.txt", uberParser())).To(Equal(Transaction{
+				Date:     "2020-10-19",
+				Amount:   23.45,
+				Merchant: "Uber",
+				Tip:      4,
+				Details:  "500 Pine St, Seattle, WA",
+			}))
+		})
+
+		It("parses Lyft rides with the tip and destination", func() {
+			Expect(parse("lyftEmail.txt", lyftParser())).To(Equal(Transaction{
+				Date:     "2020-10-19",
+				Amount:   18.60,
+				Merchant: "Lyft",
+				Tip:      3,
+				Details:  "500 Pine St, Seattle, WA",
+			}))
+		})
+
+		It("parses DoorDash orders with the restaurant and dishes", func() {
+			Expect(parse("doorDashEmail.txt", doorDashParser())).To(Equal(Transaction{
+				Date:     "2020-10-19",
+				Amount:   29.65,
+				Merchant: "DoorDash",
+				Items: []Item{
+					{Title: "Pad Thai", Price: 13.95},
+					{Title: "Spring Rolls", Price: 6.50},
+				},
+				Tip:     4,
+				Details: "Thai Palace",
+			}))
+		})
+
+		It("parses Apple receipts with each purchase", func() {
+			Expect(parse("appleEmail.txt", appleParser())).To(Equal(Transaction{
+				Date:     "2020-10-19",
+				Amount:   12.98,
+				Merchant: "Apple",
+				Items: []Item{
+					{Title: "iCloud+ 200GB Monthly", Price: 2.99},
+					{Title: "Procreate", Price: 9.99},
+				},
+			}))
+		})
+
+		It("doesn't take other stores' order confirmations as DoorDash", func() {
+			dat, _ := ioutil.ReadFile("testemails/doorDashEmail.txt")
+			Expect(selectParser(string(dat))).To(Equal(doorDashParser()))
+			Expect(selectParser("Thanks for your order, Alex\nTotal $29.65")).To(Equal(Parser{}))
+		})
+
+		It("doesn't take other stores' order confirmations as Amazon", func() {
+			dat, _ := ioutil.ReadFile("testemails/amazonEmail.txt")
+			Expect(selectParser(string(dat))).To(Equal(amazonParser()))
+			Expect(selectParser("Thank you for shopping with us, Alex\nOrder Total: $52.00")).To(Equal(Parser{}))
+		})
+
+	})
+
+})
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// SMS parsers read the text of a bank's SMS alert. They are registered like the email parsers,
+// in their own list so an email can't match an SMS parser.
+var smsParsers []Parser
+
+// Transactions from SMS alerts. Only used for reporting, the poster treats them like email alerts.
+const sourceSMS = "sms"
+
+// An empty TwiML response, Twilio doesn't send a reply
+const emptyTwiML = `<?xml version="1.0" encoding="UTF-8"?><Response></Response>`
+
+// verifyTwilioSignature checks X-Twilio-Signature: the base64 HMAC-SHA1, keyed with the auth token, of
+// the webhook URL followed by every POST parameter name and value sorted by name
+func verifyTwilioSignature(authToken, webhookURL string, params url.Values, signature string) bool {
+	if authToken == "" || signature == "" {
+		return false
+	}
+
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	mac := hmac.New(sha1.New, []byte(authToken))
+	mac.Write([]byte(webhookURL))
+	for _, name := range names {
+		for _, value := range params[name] {
+			mac.Write([]byte(name + value))
+		}
+	}
+	expected := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+func selectSMSParser(text string) Parser {
+	selected := Parser{}
+	for _, parser := range smsParsers {
+		if strings.Contains(text, parser.validationString) {
+			selected = parser
+		}
+	}
+	return selected
+}
+
+// receiveSMS handles a Twilio inbound message webhook and returns the HTTP status to answer with.
+// Messages that can't be imported are reported and acknowledged, Twilio would only send them again.
+func receiveSMS(webhookURL, signature, body string) int {
+	params, err := url.ParseQuery(body)
+	if err != nil {
+		return http.StatusBadRequest
+	}
+	if !verifyTwilioSignature(os.Getenv("TWILIO_AUTH_TOKEN"), webhookURL, params, signature) {
+		log.Printf("Rejected SMS webhook with an invalid signature for %s", webhookURL)
+		return http.StatusForbidden
+	}
+
+	messageID := "sms-" + params.Get("MessageSid")
+	text := params.Get("Body")
+
+	// The text can hold personal details, only the sender and message ID are sent to Slack
+	selectedParser = selectSMSParser(text)
+	if selectedParser == (Parser{}) {
+		notifyError(fmt.Sprintf("SMS %s from %s does not match a parser", messageID, params.Get("From")), nil)
+		return http.StatusOK
+	}
+
+	transaction, err := newTransaction(messageID, text)
+	if err != nil {
+		notifyError(fmt.Sprintf("Could not parse SMS %s from %s with the %s parser", messageID, params.Get("From"), selectedParser.name), err)
+		return http.StatusOK
+	}
+	transaction.Source = sourceSMS
+
+	err = saveTransaction(transaction, table)
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		// Twilio retried a message that was already saved
+		return http.StatusOK
+	}
+	if err != nil {
+		notifyError("Could not save SMS record to DynamoDB", err)
+		return http.StatusInternalServerError
+	}
+	return http.StatusOK
+}
+
+// HandleSMSRequest receives the webhook through an API Gateway HTTP API or a Lambda function URL
+func HandleSMSRequest(request events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	body := request.Body
+	if request.IsBase64Encoded {
+		decoded, err := base64.StdEncoding.DecodeString(body)
+		if err != nil {
+			return events.APIGatewayV2HTTPResponse{StatusCode: http.StatusBadRequest}, nil
+		}
+		body = string(decoded)
+	}
+
+	webhookURL := os.Getenv("SMS_WEBHOOK_URL")
+	if webhookURL == "" {
+		webhookURL = "https://" + request.RequestContext.DomainName + request.RawPath
+		if request.RawQueryString != "" {
+			webhookURL += "?" + request.RawQueryString
+		}
+	}
+
+	// Both pass headers with lowercase names
+	status := receiveSMS(webhookURL, request.Headers["x-twilio-signature"], body)
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode: status,
+		Headers:    map[string]string{"Content-Type": "text/xml"},
+		Body:       emptyTwiML,
+	}, nil
+}
+
+// runSMSServer receives the webhook on SMS_ADDR, for running without Lambda
+func runSMSServer(args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("usage: email sms-server (configured with SMS_* and TWILIO_AUTH_TOKEN variables)")
+	}
+	if os.Getenv("TWILIO_AUTH_TOKEN") == "" {
+		return fmt.Errorf("missing TWILIO_AUTH_TOKEN, every webhook would be rejected")
+	}
+	if table == "" {
+		return fmt.Errorf("missing dynamoDB table name")
+	}
+
+	daemon = true
+	addr := getEnvDefault("SMS_ADDR", ":8080")
+	log.Printf("Receiving SMS webhooks on %s", addr)
+	return http.ListenAndServe(addr, http.HandlerFunc(serveSMS))
+}
+
+func serveSMS(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST only", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, 64<<10))
+	if err != nil {
+		http.Error(w, "Could not read body", http.StatusBadRequest)
+		return
+	}
+
+	// Behind a proxy the URL Twilio signed has to be configured
+	webhookURL := os.Getenv("SMS_WEBHOOK_URL")
+	if webhookURL == "" {
+		webhookURL = "http://" + r.Host + r.URL.RequestURI()
+	}
+
+	processing.Lock()
+	status := receiveSMS(webhookURL, r.Header.Get("X-Twilio-Signature"), string(body))
+	processing.Unlock()
+
+	w.Header().Set("Content-Type", "text/xml")
+	w.WriteHeader(status)
+	w.Write([]byte(emptyTwiML))
+}
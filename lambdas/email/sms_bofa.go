@@ -0,0 +1,19 @@
+package main
+
+func init() {
+	parser := bofaSMSParser()
+	smsParsers = append(smsParsers, parser)
+}
+
+// Bank of America SMS alerts give the date without a year, so the day the alert arrives is used.
+// Merchants can have dots, e.g. "AMAZON.COM", so the merchant ends at the date or "Reply STOP".
+func bofaSMSParser() Parser {
+	parser := Parser{
+		name:             "Bank of America",
+		validationString: "BofA: ",
+		fourDigitRegex:   "card ending in (\\d{4})",
+		amountRegex:      "used for \\$([\\d,]+\\.\\d+)",
+		merchantRegex:    "\\$[\\d,]+\\.\\d+ at (.+?)(?: on \\d+/\\d+)?\\.(?: Reply|$)",
+	}
+	return parser
+}
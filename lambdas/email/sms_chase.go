@@ -0,0 +1,18 @@
+package main
+
+func init() {
+	parser := chaseSMSParser()
+	smsParsers = append(smsParsers, parser)
+}
+
+// Chase card alerts by SMS don't include a date, the transaction is dated the day the alert arrives
+func chaseSMSParser() Parser {
+	parser := Parser{
+		name:             "Chase",
+		validationString: "Chase: A $",
+		fourDigitRegex:   "card ending in (\\d{4})",
+		amountRegex:      "A \\$([\\d,]+\\.\\d+) transaction",
+		merchantRegex:    "transaction with (.+?) was made",
+	}
+	return parser
+}
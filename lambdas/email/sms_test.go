@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Receive SMS alerts", func() {
+
+	// SMS alerts are dated the day they arrive. Accept either day when the test runs across midnight.
+	today := func() string { return time.Now().Add(time.Hour * -6).Format("2006-01-02") }
+	parse := func(text string) Transaction {
+		selectedParser = selectSMSParser(text)
+		Expect(selectedParser).NotTo(Equal(Parser{}))
+		before := today()
+		transaction, err := parseEmail(text)
+		Expect(err).To(BeNil())
+		Expect(transaction.Date).To(Or(Equal(before), Equal(today())))
+		transaction.Date = ""
+		return transaction
+	}
+
+	Context("When given a Twilio webhook, ", func() {
+
+		params := url.Values{
+			"CallSid": {"CA1234567890ABCDE"},
+			"Caller":  {"+14158675309"},
+			"Digits":  {"1234"},
+			"From":    {"+14158675309"},
+			"To":      {"+18005551212"},
+		}
+		webhookURL := "https://mycompany.com/myapp.php?foo=1&bar=2"
+
+		It("accepts the signature from Twilio's documentation", func() {
+			Expect(verifyTwilioSignature("12345", webhookURL, params, "RSOYDt4T1cUTdK1PDd93/VVr8B8=")).To(BeTrue())
+		})
+
+		It("rejects other signatures", func() {
+			Expect(verifyTwilioSignature("12345", webhookURL+"&baz=3", params, "RSOYDt4T1cUTdK1PDd93/VVr8B8=")).To(BeFalse())
+			Expect(verifyTwilioSignature("", webhookURL, params, "")).To(BeFalse())
+		})
+
+		It("answers 403 before parsing a webhook with a bad signature", func() {
+			os.Setenv("TWILIO_AUTH_TOKEN", "12345")
+			defer os.Unsetenv("TWILIO_AUTH_TOKEN")
+			Expect(receiveSMS(webhookURL, "forged", params.Encode())).To(Equal(http.StatusForbidden))
+		})
+	})
+
+	Context("When given an SMS to parse, ", func() {
+
+		It("parses Chase card alerts", func() {
+			Expect(parse("Chase: A $1,045.67 transaction with CORNER COFFEE was made on your card ending in 4567. Reply STOP to cancel.")).To(Equal(Transaction{
+				LastDigits: 4567,
+				Amount:     1045.67,
+				Merchant:   "CORNER COFFEE",
+			}))
+		})
+
+		It("parses Bank of America debit card alerts", func() {
+			Expect(parse("BofA: Debit card ending in 4567 was used for $12.34 at TARGET T-1234 on 10/20. Reply STOP to end")).To(Equal(Transaction{
+				LastDigits: 4567,
+				Amount:     12.34,
+				Merchant:   "TARGET T-1234",
+			}))
+		})
+
+		It("keeps the dots in Bank of America merchants", func() {
+			Expect(parse("BofA: Credit card ending in 1234 was used for $52.00 at AMAZON.COM on 10/20. Reply STOP to end")).To(Equal(Transaction{
+				LastDigits: 1234,
+				Amount:     52.00,
+				Merchant:   "AMAZON.COM",
+			}))
+			Expect(parse("BofA: Credit card ending in 1234 was used for $5.00 at ST. LOUIS BREAD CO. Reply STOP to end").Merchant).To(Equal("ST. LOUIS BREAD CO"))
+		})
+
+		It("doesn't match email parsers", func() {
+			Expect(selectSMSParser("Your verification code is 123456")).To(Equal(Parser{}))
+		})
+	})
+})
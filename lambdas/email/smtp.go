@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/mail"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/emersion/go-smtp"
+)
+
+// smtpConfig is read from the SMTP_* variables
+type smtpConfig struct {
+	Addr   string
+	Domain string
+	// Addresses mail is accepted for. "@example.com" accepts the whole domain.
+	Recipients      []string
+	MaxMessageBytes int
+	// STARTTLS is offered when both are set
+	TLSCert string
+	TLSKey  string
+}
+
+func smtpConfigFromEnv() (smtpConfig, error) {
+	config := smtpConfig{
+		Addr:            getEnvDefault("SMTP_ADDR", ":2525"),
+		Domain:          getEnvDefault("SMTP_DOMAIN", "localhost"),
+		MaxMessageBytes: 10 << 20,
+		TLSCert:         os.Getenv("SMTP_TLS_CERT"),
+		TLSKey:          os.Getenv("SMTP_TLS_KEY"),
+	}
+	for _, recipient := range strings.Split(os.Getenv("SMTP_RECIPIENTS"), ",") {
+		if recipient = strings.TrimSpace(recipient); recipient != "" {
+			config.Recipients = append(config.Recipients, strings.ToLower(recipient))
+		}
+	}
+	if len(config.Recipients) == 0 {
+		return config, fmt.Errorf("missing SMTP_RECIPIENTS, refusing to accept mail for anyone")
+	}
+	if size := os.Getenv("SMTP_MAX_BYTES"); size != "" {
+		value, err := strconv.Atoi(size)
+		if err != nil {
+			return config, fmt.Errorf("invalid SMTP_MAX_BYTES: %v", err)
+		}
+		config.MaxMessageBytes = value
+	}
+	if (config.TLSCert == "") != (config.TLSKey == "") {
+		return config, fmt.Errorf("SMTP_TLS_CERT and SMTP_TLS_KEY must be set together")
+	}
+	return config, nil
+}
+
+func (c smtpConfig) accepts(recipient string) bool {
+	recipient = strings.ToLower(recipient)
+	for _, allowed := range c.Recipients {
+		if recipient == allowed || (strings.HasPrefix(allowed, "@") && strings.HasSuffix(recipient, allowed)) {
+			return true
+		}
+	}
+	return false
+}
+
+func newSMTPServer(config smtpConfig) (*smtp.Server, error) {
+	server := smtp.NewServer(&smtpBackend{config: config})
+	server.Addr = config.Addr
+	server.Domain = config.Domain
+	server.MaxMessageBytes = config.MaxMessageBytes
+	server.MaxRecipients = 10
+	server.ReadTimeout = time.Minute
+	server.WriteTimeout = time.Minute
+	server.AuthDisabled = true
+
+	if config.TLSCert != "" {
+		cert, err := tls.LoadX509KeyPair(config.TLSCert, config.TLSKey)
+		if err != nil {
+			return nil, err
+		}
+		server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+	return server, nil
+}
+
+type smtpBackend struct {
+	config smtpConfig
+}
+
+func (b *smtpBackend) Login(state *smtp.ConnectionState, username, password string) (smtp.Session, error) {
+	return nil, smtp.ErrAuthUnsupported
+}
+
+// AnonymousLogin is how forwarding servers connect. Only the recipients are checked.
+func (b *smtpBackend) AnonymousLogin(state *smtp.ConnectionState) (smtp.Session, error) {
+	return &smtpSession{config: b.config}, nil
+}
+
+type smtpSession struct {
+	config smtpConfig
+	from   string
+}
+
+func (s *smtpSession) Reset() {
+	s.from = ""
+}
+
+func (s *smtpSession) Logout() error {
+	return nil
+}
+
+func (s *smtpSession) Mail(from string, opts smtp.MailOptions) error {
+	if opts.Size > s.config.MaxMessageBytes {
+		return smtp.ErrDataTooLarge
+	}
+	s.from = from
+	return nil
+}
+
+func (s *smtpSession) Rcpt(to string) error {
+	if !s.config.accepts(to) {
+		return &smtp.SMTPError{Code: 550, EnhancedCode: smtp.EnhancedCode{5, 1, 1}, Message: "No such recipient"}
+	}
+	return nil
+}
+
+// processing is held while an email is parsed, the parsers share selectedParser
+var processing sync.Mutex
+
+// Data saves the email to the mail store and processes it like an email from SES. Failures that may go
+// away are returned as temporary errors so the sending server tries again later.
+func (s *smtpSession) Data(r io.Reader) error {
+	raw, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	var header mail.Header
+	if message, err := mail.ReadMessage(bytes.NewReader(raw)); err == nil {
+		header = message.Header
+	}
+	// A retried delivery gets the same ID, so the DynamoDB check catches it
+	sesMail := events.SimpleEmailMessage{MessageID: hashedMessageID("smtp", header, raw), Source: s.from}
+	sesMail.CommonHeaders.Subject = header.Get("Subject")
+	if from := header.Get("From"); from != "" {
+		sesMail.CommonHeaders.From = []string{from}
+	}
+
+	processing.Lock()
+	result := importMail(sesMail, raw)
+	processing.Unlock()
+
+	summary, retryErr := summarizeResults([]recordResult{result})
+	if summary != "" {
+		notifyError(summary, nil)
+	}
+	if retryErr != nil {
+		return &smtp.SMTPError{Code: 451, EnhancedCode: smtp.EnhancedCode{4, 3, 0}, Message: "Try again later"}
+	}
+	return nil
+}
+
+// runSMTP receives mail until the listener fails
+func runSMTP(args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("usage: email smtp (configured with SMTP_* variables)")
+	}
+	config, err := smtpConfigFromEnv()
+	if err != nil {
+		return err
+	}
+	if table == "" {
+		return fmt.Errorf("missing dynamoDB table name")
+	}
+	daemon = true
+	mailSource, err = newMailSource()
+	if err != nil {
+		return err
+	}
+
+	server, err := newSMTPServer(config)
+	if err != nil {
+		return err
+	}
+	log.Printf("Receiving mail for %s on %s", strings.Join(config.Recipients, ", "), config.Addr)
+	return server.ListenAndServe()
+}
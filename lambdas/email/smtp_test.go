@@ -0,0 +1,104 @@
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/emersion/go-smtp"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SMTP receiver", func() {
+
+	var (
+		dir      string
+		listener net.Listener
+		email    string
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "smtp")
+		Expect(err).To(BeNil())
+		mailSource = localMailSource{dir: dir}
+
+		server, err := newSMTPServer(smtpConfig{
+			Domain:          "localhost",
+			Recipients:      []string{"alerts@example.com", "@ynab.example.com"},
+			MaxMessageBytes: 1024,
+		})
+		Expect(err).To(BeNil())
+		listener, err = net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).To(BeNil())
+		go server.Serve(listener)
+
+		dat, _ := ioutil.ReadFile("testemails/spamEmail.txt")
+		email = string(dat)
+	})
+
+	AfterEach(func() {
+		listener.Close()
+		mailSource = nil
+		os.RemoveAll(dir)
+	})
+
+	send := func(to string, body string) error {
+		return smtp.SendMail(listener.Addr().String(), nil, "forwarder@example.com", []string{to}, strings.NewReader(body))
+	}
+
+	It("processes mail for configured recipients", func() {
+		Expect(send("Alerts@example.com", email)).To(Succeed())
+		other := strings.Replace(email, "Message-ID:", "Message-ID: <other@example.com>", 1)
+		Expect(send("me@ynab.example.com", other)).To(Succeed())
+
+		// Nothing parses the spam email, so both are quarantined
+		sidecars, _ := filepath.Glob(filepath.Join(dir, "quarantine", "smtp-*.json"))
+		Expect(sidecars).To(HaveLen(2))
+	})
+
+	It("doesn't import a redelivered email twice", func() {
+		saved := map[string]bool{}
+		saveTransaction = func(transaction Transaction, tableName string) error {
+			if saved[transaction.MessageID] {
+				return awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "exists", nil)
+			}
+			saved[transaction.MessageID] = true
+			return nil
+		}
+		defer func() { saveTransaction = saveToDynamoDB }()
+
+		dat, _ := ioutil.ReadFile("testemails/citiEmail.eml")
+		Expect(send("alerts@example.com", string(dat))).To(Succeed())
+		Expect(saved).To(HaveLen(1))
+		stored, _ := filepath.Glob(filepath.Join(dir, "smtp-*"))
+		Expect(stored).To(HaveLen(1))
+
+		// The sending server retries, the poster hasn't run yet
+		Expect(send("alerts@example.com", string(dat))).To(Succeed())
+		Expect(saved).To(HaveLen(1))
+		Expect(stored[0]).To(BeAnExistingFile())
+
+		// The poster posted it and deleted the copy, the new one isn't left behind
+		Expect(os.Remove(stored[0])).To(Succeed())
+		Expect(send("alerts@example.com", string(dat))).To(Succeed())
+		Expect(saved).To(HaveLen(1))
+		Expect(stored[0]).NotTo(BeAnExistingFile())
+	})
+
+	It("rejects other recipients", func() {
+		Expect(send("someone@example.org", email)).NotTo(Succeed())
+	})
+
+	It("rejects messages over the size limit", func() {
+		Expect(send("alerts@example.com", email+strings.Repeat("padding line\r\n", 200))).NotTo(Succeed())
+		files, _ := ioutil.ReadDir(dir)
+		Expect(files).To(BeEmpty())
+	})
+
+})
@@ -0,0 +1,21 @@
+package main
+
+func init() {
+	parser := uberParser()
+	parsers = append(parsers, parser)
+}
+
+// Uber receipts add the destination and tip to the "UBER *TRIP" charge
+func uberParser() Parser {
+	parser := Parser{
+		name:             "Uber",
+		validationString: "Thanks for riding, ",
+		amountRegex:      "(?m)^Total \\$([\\d,]+\\.\\d+)",
+		dateRegex:        "(?m)^(\\w+ \\d+, \\d+)\\r?$",
+		dateLayout:       "Jan 02, 2006",
+		tipRegex:         "(?m)^Tip \\$([\\d,]+\\.\\d+)",
+		detailsRegex:     "(?m)^Dropoff: \\d+:\\d+ [AP]M (.*)$",
+		kind:             "receipt",
+	}
+	return parser
+}
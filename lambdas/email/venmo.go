@@ -0,0 +1,42 @@
+package main
+
+func init() {
+	parsers = append(parsers, venmoPaidParser(), venmoReceivedParser())
+}
+
+// Every Venmo email ends with this. Phrases like "You paid" are in plenty of other emails.
+const venmoFooter = "Venmo is a service of PayPal, Inc."
+
+// Venmo receipts name the person paid and carry the note, the card alert only shows "VENMO *..."
+func venmoPaidParser() Parser {
+	parser := Parser{
+		name:             "Venmo",
+		validationString: venmoFooter,
+		fourDigitRegex:   "Payment method: .* ending in (\\d+)",
+		amountRegex:      "You paid .* \\$([\\d,]+\\.\\d+)",
+		merchantRegex:    "You paid (.*) \\$[\\d,]+\\.\\d+",
+		dateRegex:        "(?m)^Date: (\\w+ \\d+, \\d+)",
+		dateLayout:       "Jan 02, 2006",
+		memoRegex:        "(?m)^Note: (.*)$",
+		wallet:           "Venmo",
+		balanceString:    "Payment method: Venmo balance",
+	}
+	return parser
+}
+
+// Money received always goes to the Venmo balance. Registered after payments so it wins
+// for received emails, which have the footer too.
+func venmoReceivedParser() Parser {
+	parser := Parser{
+		name:             "Venmo",
+		validationString: "available in your Venmo balance",
+		amountRegex:      "paid you \\$([\\d,]+\\.\\d+)",
+		merchantRegex:    "(?m)^(.*) paid you \\$",
+		dateRegex:        "(?m)^Date: (\\w+ \\d+, \\d+)",
+		dateLayout:       "Jan 02, 2006",
+		memoRegex:        "(?m)^Note: (.*)$",
+		kind:             "deposit",
+		wallet:           "Venmo",
+	}
+	return parser
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"io/ioutil"
+	"strings"
+)
+
+var _ = Describe("Parse Venmo emails", func() {
+
+	parse := func(file string, parser Parser, edit func(string) string) Transaction {
+		dat, _ := ioutil.ReadFile("testemails/" + file)
+		selectedParser = parser
+		transaction, err := parseEmail(edit(string(dat)))
+		Expect(err).To(BeNil())
+		return transaction
+	}
+	unchanged := func(body string) string { return body }
+
+	Context("When given an email body to parse, ", func() {
+
+		It("parses payments from the Venmo balance", func() {
+			Expect(parse("venmoPaidEmail.txt", venmoPaidParser(), unchanged)).To(Equal(Transaction{
+				Date:     "2020-10-19",
+				Amount:   25.00,
+				Merchant: "John Smith",
+				Memo:     "Pizza night",
+				Wallet:   "Venmo",
+			}))
+		})
+
+		It("parses payments from a card", func() {
+			withCard := func(body string) string {
+				return strings.Replace(body, "Venmo balance", "Visa Debit ending in 4321", 1)
+			}
+			Expect(parse("venmoPaidEmail.txt", venmoPaidParser(), withCard)).To(Equal(Transaction{
+				LastDigits: 4321,
+				Date:       "2020-10-19",
+				Amount:     25.00,
+				Merchant:   "John Smith",
+				Memo:       "Pizza night",
+			}))
+		})
+
+		It("parses money received into the Venmo balance", func() {
+			Expect(parse("venmoReceivedEmail.txt", venmoReceivedParser(), unchanged)).To(Equal(Transaction{
+				Date:     "2020-10-19",
+				Amount:   12.50,
+				Merchant: "Jane Doe",
+				Memo:     "Coffee",
+				Wallet:   "Venmo",
+			}))
+		})
+
+		It("only selects the Venmo parsers for Venmo emails", func() {
+			paid, _ := ioutil.ReadFile("testemails/venmoPaidEmail.txt")
+			received, _ := ioutil.ReadFile("testemails/venmoReceivedEmail.txt")
+			Expect(selectParser(string(paid))).To(Equal(venmoPaidParser()))
+			Expect(selectParser(string(received))).To(Equal(venmoReceivedParser()))
+			Expect(selectParser("You paid $25.00 USD to John Smith")).To(Equal(Parser{}))
+			Expect(selectParser("Your employer paid you $1,200.00")).To(Equal(Parser{}))
+		})
+
+	})
+
+})
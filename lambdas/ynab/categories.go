@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	ynabcategory "go.bmvs.io/ynab/api/category"
+)
+
+const categoryCacheTTL = time.Hour
+
+var categoryCache = struct {
+	sync.Mutex
+	budgets map[string]cachedCategories
+}{budgets: map[string]cachedCategories{}}
+
+type cachedCategories struct {
+	groups    []*ynabcategory.GroupWithCategories
+	fetchedAt time.Time
+}
+
+func getCategories(client *ynabClient, budgetID string) ([]*ynabcategory.GroupWithCategories, error) {
+	categoryCache.Lock()
+	defer categoryCache.Unlock()
+
+	cached, ok := categoryCache.budgets[budgetID]
+	if ok && time.Since(cached.fetchedAt) < categoryCacheTTL {
+		return cached.groups, nil
+	}
+
+	var groups []*ynabcategory.GroupWithCategories
+	err := client.call("get categories", func() (err error) {
+		groups, err = client.Category().GetCategories(budgetID)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	categoryCache.budgets[budgetID] = cachedCategories{groups: groups, fetchedAt: time.Now()}
+	return groups, nil
+}
+
+// findCategoryID resolves a category name from the config to its YNAB ID. Names may be
+// qualified with their group ("Everyday Expenses: Groceries") when a name is used twice.
+func findCategoryID(groups []*ynabcategory.GroupWithCategories, name string) (string, error) {
+	groupName := ""
+	categoryName := strings.TrimSpace(name)
+	if parts := strings.SplitN(name, ":", 2); len(parts) == 2 {
+		groupName = strings.TrimSpace(parts[0])
+		categoryName = strings.TrimSpace(parts[1])
+	}
+
+	var matches []string
+	for _, group := range groups {
+		if group.Deleted {
+			continue
+		}
+		if groupName != "" && !strings.EqualFold(group.Name, groupName) {
+			continue
+		}
+		for _, category := range group.Categories {
+			if !category.Deleted && strings.EqualFold(category.Name, categoryName) {
+				matches = append(matches, category.ID)
+			}
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("could not find category %q", name)
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("category %q is ambiguous, prefix it with its group name", name)
+	}
+}
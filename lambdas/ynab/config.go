@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+)
+
+const defaultConfigFile = "config.json"
+
+// posterConfig holds the optional settings that change how transactions are posted.
+// It is read from a JSON file shipped next to the lambda binary. See config.example.json.
+type posterConfig struct {
+	// Added to the memo of everything we post, to tell it apart from what the bank imports
+	MemoMarker string `json:"memoMarker"`
+	// Maps a merchant descriptor (case insensitive substring) to the payee name it should post as
+	PayeeAliases map[string]string `json:"payeeAliases"`
+	// Minimum similarity (0-1) before a merchant is posted to an existing payee
+	PayeeMatchThreshold float64 `json:"payeeMatchThreshold"`
+	// Evaluated in order, the first match sets the category
+	CategoryRules []categoryRule `json:"categoryRules"`
+	// Categories learned from past transactions, used when no rule matches
+	History historyConfig `json:"history"`
+	// The first template matching the card or parser becomes the memo
+	Memos []memoTemplate `json:"memos"`
+	// Evaluated in order, the first match splits the transaction across categories
+	SplitRules []splitRule `json:"splitRules"`
+	// Evaluated in order, the first match posts part of the transaction as owed by someone else
+	SharedRules []sharedRule `json:"sharedRules"`
+	// Update the original transaction when a second alert arrives for the same charge
+	Pending pendingConfig `json:"pending"`
+	// Accounts card payments are transferred from
+	Payments paymentConfig `json:"payments"`
+	// Accounts for PayPal and Venmo balances
+	Wallets walletConfig `json:"wallets"`
+	// Merge receipts, e.g. Amazon orders or Uber rides, with the card charge
+	Receipts receiptConfig `json:"receipts"`
+	// How refunds find the purchase they reverse
+	Refunds refundConfig `json:"refunds"`
+	// Look for the same transaction already in YNAB before posting
+	Duplicates duplicateConfig `json:"duplicates"`
+	// Flag colors and automatic approval
+	Policy policyConfig `json:"policy"`
+	// How the reconciliation report tells email and bank imports apart
+	Reconcile reconcileConfig `json:"reconcile"`
+}
+
+func defaultConfig() posterConfig {
+	return posterConfig{
+		MemoMarker:          "via email",
+		PayeeAliases:        map[string]string{},
+		PayeeMatchThreshold: 0.8,
+		History:             defaultHistoryConfig(),
+		Pending:             defaultPendingConfig(),
+		Duplicates:          defaultDuplicateConfig(),
+		Refunds:             defaultRefundConfig(),
+		Receipts:            defaultReceiptConfig(),
+		Policy:              defaultPolicyConfig(),
+		Reconcile:           defaultReconcileConfig(),
+	}
+}
+
+// loadConfig reads the config file. A missing file is not an error, all features
+// driven by the config are optional.
+func loadConfig(path string) (posterConfig, error) {
+	config := defaultConfig()
+	if path == "" {
+		path = defaultConfigFile
+	}
+
+	contents, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		log.Printf("No config file found at %s. Using defaults.", path)
+		return config, nil
+	}
+	if err != nil {
+		return config, err
+	}
+
+	err = json.Unmarshal(contents, &config)
+	if err != nil {
+		return config, err
+	}
+
+	err = compileRules(config.CategoryRules)
+	if err != nil {
+		return config, err
+	}
+
+	err = compileMemoTemplates(config.Memos)
+	if err != nil {
+		return config, err
+	}
+
+	err = compileSplitRules(config.SplitRules)
+	if err != nil {
+		return config, err
+	}
+
+	err = compileSharedRules(config.SharedRules)
+	if err != nil {
+		return config, err
+	}
+
+	err = config.Pending.compile()
+	if err != nil {
+		return config, fmt.Errorf("pending %v", err)
+	}
+
+	err = config.Receipts.compile()
+	if err != nil {
+		return config, fmt.Errorf("receipts %v", err)
+	}
+
+	err = config.Duplicates.validate()
+	if err != nil {
+		return config, err
+	}
+
+	err = compilePolicy(config.Policy)
+	return config, err
+}
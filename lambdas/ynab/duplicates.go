@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"go.bmvs.io/ynab/api"
+	ynabtransaction "go.bmvs.io/ynab/api/transaction"
+)
+
+// What to do with a transaction that looks like one already in YNAB
+const (
+	duplicateSkip   = "skip"
+	duplicateFlag   = "flag"
+	duplicateNotify = "notify"
+)
+
+// duplicateConfig controls checking the account for a transaction that was already
+// entered, e.g. by hand on the phone, before posting.
+type duplicateConfig struct {
+	Enabled bool `json:"enabled"`
+	// How many days apart the two transactions may be
+	WindowDays int `json:"windowDays"`
+	// skip: don't post it, flag: post it flagged, notify: post it as usual.
+	// A notification is sent in every case.
+	Action string `json:"action"`
+	// Flag color used by the flag action
+	FlagColor string `json:"flagColor"`
+}
+
+func defaultDuplicateConfig() duplicateConfig {
+	return duplicateConfig{
+		WindowDays: 3,
+		Action:     duplicateNotify,
+		FlagColor:  "orange",
+	}
+}
+
+func (d duplicateConfig) validate() error {
+	switch d.Action {
+	case duplicateSkip, duplicateFlag, duplicateNotify:
+	default:
+		return fmt.Errorf("duplicate action must be %s, %s or %s", duplicateSkip, duplicateFlag, duplicateNotify)
+	}
+	if _, ok := flagColors[strings.ToLower(d.FlagColor)]; !ok {
+		return fmt.Errorf("duplicate flag color %q is unknown", d.FlagColor)
+	}
+	return nil
+}
+
+// getRecentTransactions fetches the account's transactions going back far enough for the
+// pending and duplicate checks. It returns nil without a request when both are disabled.
+func getRecentTransactions(client *ynabClient, account budgetAccount, date api.Date, config posterConfig) ([]*ynabtransaction.Transaction, error) {
+	if !config.Pending.Enabled && !config.Duplicates.Enabled {
+		return nil, nil
+	}
+	days := 0
+	if config.Pending.Enabled {
+		days = config.Pending.WindowDays
+	}
+	if config.Duplicates.Enabled && config.Duplicates.WindowDays > days {
+		days = config.Duplicates.WindowDays
+	}
+
+	since := api.Date{Time: date.AddDate(0, 0, -days)}
+	var transactions []*ynabtransaction.Transaction
+	err := client.call("get recent transactions", func() (err error) {
+		transactions, err = client.Transaction().GetTransactionsByAccount(account.budgetID, account.account.ID, &ynabtransaction.Filter{Since: &since})
+		return
+	})
+	return transactions, err
+}
+
+// findDuplicate returns a transaction with the same amount and a similar payee within the window
+func findDuplicate(recent []*ynabtransaction.Transaction, payload ynabtransaction.PayloadTransaction, config posterConfig) *ynabtransaction.Transaction {
+	if !config.Duplicates.Enabled {
+		return nil
+	}
+
+	window := float64(config.Duplicates.WindowDays)
+	for _, existing := range recent {
+		if existing.Deleted || existing.Amount != payload.Amount {
+			continue
+		}
+		days := existing.Date.Sub(payload.Date.Time).Hours() / 24
+		if days > window || days < -window {
+			continue
+		}
+		if samePayee(existing, payload, config.PayeeMatchThreshold) {
+			return existing
+		}
+	}
+	return nil
+}
+
+// markDuplicate flags the payload and says in its memo which transaction it may duplicate
+func markDuplicate(payload *ynabtransaction.PayloadTransaction, existing *ynabtransaction.Transaction, duplicates duplicateConfig) {
+	color := flagColors[strings.ToLower(duplicates.FlagColor)]
+	payload.FlagColor = &color
+
+	memo := "Possible duplicate of " + existing.Date.Format("2006-01-02")
+	if payload.Memo != nil && *payload.Memo != "" {
+		memo += " | " + *payload.Memo
+	}
+	memo = truncate(memo, maxMemoLength)
+	payload.Memo = &memo
+}
+
+// describeTransaction is used in notifications about a transaction already in YNAB
+func describeTransaction(transaction *ynabtransaction.Transaction) string {
+	payee := "unknown payee"
+	if transaction.PayeeName != nil {
+		payee = *transaction.PayeeName
+	}
+	return fmt.Sprintf("%s %.2f on %s", payee, float64(-transaction.Amount)/1000, transaction.Date.Format("2006-01-02"))
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go.bmvs.io/ynab/api"
+	ynabtransaction "go.bmvs.io/ynab/api/transaction"
+)
+
+var _ = Describe("Duplicate detection", func() {
+
+	var (
+		config       posterConfig
+		payload      ynabtransaction.PayloadTransaction
+		transactions []*ynabtransaction.Transaction
+	)
+
+	BeforeEach(func() {
+		config = defaultConfig()
+		config.Duplicates.Enabled = true
+
+		date, _ := api.DateFromString("2020-10-16")
+		payee := "Corner Coffee"
+		payload = ynabtransaction.PayloadTransaction{Date: date, Amount: -4500, PayeeName: &payee}
+
+		transactions = []*ynabtransaction.Transaction{
+			ynabTransaction("other", "2020-10-16", -4500, "Gas Station", ""),
+			ynabTransaction("amount", "2020-10-16", -4750, "Corner Coffee", ""),
+			ynabTransaction("old", "2020-10-10", -4500, "Corner Coffee", ""),
+		}
+	})
+
+	Context("When the account has recent transactions, ", func() {
+
+		It("finds one entered by hand", func() {
+			transactions = append(transactions, ynabTransaction("manual", "2020-10-15", -4500, "Corner Coffee Co", ""))
+			match := findDuplicate(transactions, payload, config)
+			Expect(match).NotTo(BeNil())
+			Expect(match.ID).To(Equal("manual"))
+		})
+
+		It("ignores different amounts, payees and old transactions", func() {
+			Expect(findDuplicate(transactions, payload, config)).To(BeNil())
+		})
+
+		It("does nothing when disabled", func() {
+			config.Duplicates.Enabled = false
+			transactions = append(transactions, ynabTransaction("manual", "2020-10-16", -4500, "Corner Coffee", ""))
+			Expect(findDuplicate(transactions, payload, config)).To(BeNil())
+		})
+	})
+
+	Context("When posting a duplicate flagged, ", func() {
+
+		It("flags it and notes the original in the memo", func() {
+			memo := "Card 1234"
+			payload.Memo = &memo
+			markDuplicate(&payload, ynabTransaction("manual", "2020-10-15", -4500, "Corner Coffee", ""), config.Duplicates)
+			Expect(*payload.FlagColor).To(Equal(ynabtransaction.FlagColorOrange))
+			Expect(*payload.Memo).To(Equal("Possible duplicate of 2020-10-15 | Card 1234"))
+		})
+	})
+
+	It("rejects an unknown action", func() {
+		config.Duplicates.Action = "delete"
+		Expect(config.Duplicates.validate()).To(HaveOccurred())
+	})
+
+})
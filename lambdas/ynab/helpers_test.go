@@ -0,0 +1,27 @@
+package main
+
+import (
+	"go.bmvs.io/ynab/api"
+	ynabtransaction "go.bmvs.io/ynab/api/transaction"
+)
+
+// ynabTransaction is a transaction already in YNAB: uncleared, in the category "<id>category",
+// with the payee and memo when they aren't empty.
+func ynabTransaction(id, date string, amount int64, payee, memo string) *ynabtransaction.Transaction {
+	d, _ := api.DateFromString(date)
+	category := id + "category"
+	transaction := &ynabtransaction.Transaction{ID: id, Date: d, Amount: amount, CategoryID: &category, Cleared: ynabtransaction.ClearingStatusUncleared}
+	if payee != "" {
+		transaction.PayeeName = &payee
+	}
+	if memo != "" {
+		transaction.Memo = &memo
+	}
+	return transaction
+}
+
+// imported gives the transaction the import ID of a bank import
+func imported(transaction *ynabtransaction.Transaction, importID string) *ynabtransaction.Transaction {
+	transaction.ImportID = &importID
+	return transaction
+}
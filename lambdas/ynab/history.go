@@ -0,0 +1,196 @@
+package main
+
+import (
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"go.bmvs.io/ynab/api"
+	ynabtransaction "go.bmvs.io/ynab/api/transaction"
+)
+
+// historyConfig controls category suggestions learned from the budget's past transactions
+type historyConfig struct {
+	Enabled bool `json:"enabled"`
+	// How far back to learn from
+	Days int `json:"days"`
+	// How often a warm container rebuilds the model
+	RefreshHours int `json:"refreshHours"`
+	// Share (0-1) of a payee's transactions that must be in one category before it is used
+	Threshold float64 `json:"threshold"`
+	// Payees seen fewer times than this are never suggested
+	MinSamples int `json:"minSamples"`
+}
+
+func defaultHistoryConfig() historyConfig {
+	return historyConfig{
+		Days:         365,
+		RefreshHours: 24,
+		Threshold:    0.8,
+		MinSamples:   3,
+	}
+}
+
+// historyModel counts how often each payee was put in each category
+type historyModel struct {
+	builtAt time.Time
+	// keyed by payee ID and by normalized payee name
+	payees map[string]*payeeHistory
+}
+
+type payeeHistory struct {
+	total      int
+	categories map[string]*categoryCount
+}
+
+type categoryCount struct {
+	categoryID string
+	count      int
+	// count per amount bucket, used to break ties
+	buckets map[int]int
+}
+
+// categorySuggestion is a category learned from history and how confident we are in it
+type categorySuggestion struct {
+	categoryID string
+	confidence float64
+	samples    int
+}
+
+var historyCache = struct {
+	sync.Mutex
+	budgets map[string]*historyModel
+}{budgets: map[string]*historyModel{}}
+
+// getHistoryModel returns the cached model for the budget, rebuilding it when it is stale
+func getHistoryModel(client *ynabClient, budgetID string, config historyConfig) (*historyModel, error) {
+	historyCache.Lock()
+	defer historyCache.Unlock()
+
+	model, ok := historyCache.budgets[budgetID]
+	refresh := time.Duration(config.RefreshHours) * time.Hour
+	if ok && time.Since(model.builtAt) < refresh {
+		return model, nil
+	}
+
+	since := api.Date{Time: time.Now().AddDate(0, 0, -config.Days)}
+	var transactions []*ynabtransaction.Transaction
+	err := client.call("get transaction history", func() (err error) {
+		transactions, err = client.Transaction().GetTransactions(budgetID, &ynabtransaction.Filter{Since: &since})
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	model = buildHistoryModel(transactions)
+	log.Printf("Built category history from %d transactions", len(transactions))
+	historyCache.budgets[budgetID] = model
+	return model, nil
+}
+
+func buildHistoryModel(transactions []*ynabtransaction.Transaction) *historyModel {
+	model := &historyModel{builtAt: time.Now(), payees: map[string]*payeeHistory{}}
+	for _, transaction := range transactions {
+		// Transfers, splits and uncategorized transactions say nothing about where a payee belongs
+		if transaction.Deleted || transaction.TransferAccountID != nil || transaction.CategoryID == nil ||
+			len(transaction.SubTransactions) > 0 {
+			continue
+		}
+		if transaction.PayeeID != nil {
+			model.add(*transaction.PayeeID, *transaction.CategoryID, transaction.Amount)
+		}
+		if transaction.PayeeName != nil {
+			model.add(normalizeName(*transaction.PayeeName), *transaction.CategoryID, transaction.Amount)
+		}
+	}
+	return model
+}
+
+func (m *historyModel) add(payee, categoryID string, amount int64) {
+	if payee == "" {
+		return
+	}
+	history, ok := m.payees[payee]
+	if !ok {
+		history = &payeeHistory{categories: map[string]*categoryCount{}}
+		m.payees[payee] = history
+	}
+	count, ok := history.categories[categoryID]
+	if !ok {
+		count = &categoryCount{categoryID: categoryID, buckets: map[int]int{}}
+		history.categories[categoryID] = count
+	}
+	history.total++
+	count.count++
+	count.buckets[amountBucket(amount)]++
+}
+
+// suggest picks the payee's most common category. When categories are used equally
+// often, the one used most for similar amounts wins.
+func (m *historyModel) suggest(payeeID *string, payeeName *string, amount int64) (categorySuggestion, bool) {
+	var history *payeeHistory
+	if payeeID != nil {
+		history = m.payees[*payeeID]
+	}
+	if history == nil && payeeName != nil {
+		history = m.payees[normalizeName(*payeeName)]
+	}
+	if history == nil {
+		return categorySuggestion{}, false
+	}
+
+	counts := make([]*categoryCount, 0, len(history.categories))
+	for _, count := range history.categories {
+		counts = append(counts, count)
+	}
+	bucket := amountBucket(amount)
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].count != counts[j].count {
+			return counts[i].count > counts[j].count
+		}
+		if counts[i].buckets[bucket] != counts[j].buckets[bucket] {
+			return counts[i].buckets[bucket] > counts[j].buckets[bucket]
+		}
+		return counts[i].categoryID < counts[j].categoryID
+	})
+
+	best := counts[0]
+	return categorySuggestion{
+		categoryID: best.categoryID,
+		confidence: float64(best.count) / float64(history.total),
+		samples:    history.total,
+	}, true
+}
+
+// Amounts are bucketed by order of magnitude in halves: $1-3, $3-10, $10-31, $31-100...
+func amountBucket(amount int64) int {
+	dollars := math.Abs(float64(amount)) / 1000
+	if dollars < 1 {
+		return 0
+	}
+	return int(math.Log10(dollars)*2) + 1
+}
+
+// suggestCategory returns a category learned from history if it is confident enough
+func suggestCategory(client *ynabClient, budgetID string, payload ynabtransaction.PayloadTransaction, config historyConfig) (*string, error) {
+	model, err := getHistoryModel(client, budgetID, config)
+	if err != nil {
+		return nil, err
+	}
+
+	suggestion, ok := model.suggest(payload.PayeeID, payload.PayeeName, payload.Amount)
+	if !ok {
+		return nil, nil
+	}
+	if suggestion.samples < config.MinSamples || suggestion.confidence < config.Threshold {
+		log.Printf("Leaving transaction uncategorized. Best history match %s had confidence %.2f over %d transactions",
+			suggestion.categoryID, suggestion.confidence, suggestion.samples)
+		return nil, nil
+	}
+
+	log.Printf("Categorizing from history with confidence %.2f over %d transactions", suggestion.confidence, suggestion.samples)
+	return &suggestion.categoryID, nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	ynabtransaction "go.bmvs.io/ynab/api/transaction"
+)
+
+var _ = Describe("Category history", func() {
+
+	var model *historyModel
+
+	transaction := func(payeeID, categoryID string, amount int64) *ynabtransaction.Transaction {
+		return &ynabtransaction.Transaction{PayeeID: &payeeID, CategoryID: &categoryID, Amount: amount}
+	}
+
+	BeforeEach(func() {
+		transfer := "savingsid"
+		transferTransaction := transaction("transferpayeeid", "groceriesid", -100000)
+		transferTransaction.TransferAccountID = &transfer
+
+		model = buildHistoryModel([]*ynabtransaction.Transaction{
+			transaction("netflixid", "subscriptionsid", -15990),
+			transaction("netflixid", "subscriptionsid", -15990),
+			transaction("netflixid", "subscriptionsid", -15990),
+			transaction("netflixid", "entertainmentid", -15990),
+			transaction("costcoid", "groceriesid", -250000),
+			transaction("costcoid", "groceriesid", -310000),
+			transaction("costcoid", "householdid", -12000),
+			transaction("costcoid", "householdid", -15000),
+			transferTransaction,
+		})
+	})
+
+	Context("When suggesting a category, ", func() {
+
+		It("picks the most common category for the payee", func() {
+			payeeID := "netflixid"
+			suggestion, ok := model.suggest(&payeeID, nil, -15990)
+			Expect(ok).To(BeTrue())
+			Expect(suggestion.categoryID).To(Equal("subscriptionsid"))
+			Expect(suggestion.confidence).To(Equal(0.75))
+			Expect(suggestion.samples).To(Equal(4))
+		})
+
+		It("breaks ties with similar amounts", func() {
+			payeeID := "costcoid"
+			suggestion, _ := model.suggest(&payeeID, nil, -280000)
+			Expect(suggestion.categoryID).To(Equal("groceriesid"))
+			suggestion, _ = model.suggest(&payeeID, nil, -13500)
+			Expect(suggestion.categoryID).To(Equal("householdid"))
+		})
+
+		It("ignores transfers and unknown payees", func() {
+			payeeID := "transferpayeeid"
+			_, ok := model.suggest(&payeeID, nil, -100000)
+			Expect(ok).To(BeFalse())
+		})
+	})
+
+})
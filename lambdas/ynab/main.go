@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -13,7 +14,6 @@ import (
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/joho/godotenv"
-	"go.bmvs.io/ynab"
 	"go.bmvs.io/ynab/api"
 	ynabaccount "go.bmvs.io/ynab/api/account"
 	ynabbudget "go.bmvs.io/ynab/api/budget"
@@ -21,6 +21,7 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -31,6 +32,7 @@ type credentials struct {
 	bucketName  string
 	tableName   string
 	slackURL    string
+	configFile  string
 }
 
 type budgetAccount struct {
@@ -44,10 +46,39 @@ type Transaction struct {
 	Date       string
 	Amount     float32
 	Merchant   string
+	Parser     string
+	Time       string
+	Currency   string
+	Type       string
+	Memo       string
+	Wallet     string
+	Source     string
+	Settled    bool
 }
 
+// Transaction types set by the email parsers. Records from before types were added are purchases.
+const (
+	transactionPurchase = ""
+	transactionPayment  = "payment"
+	transactionRefund   = "refund"
+	transactionDeposit  = "deposit"
+	// Receipts wait in the table for their card charge
+	transactionReceipt = "receipt"
+)
+
+// Emails imported in bulk by the email backfill command. Anything else is a live alert.
+const sourceBackfill = "backfill"
+
+// Posted backfill records stay in the table this long, so running the backfill again skips them
+// wherever it runs
+const backfillRecordTTL = 365 * 24 * time.Hour
+
 const region = "us-west-2"
 
+// An entry in an account note naming the last digits, e.g. "4567", "*4567" or "ending in 4567".
+// Some cards have five digits in their alerts.
+var accountNumber = regexp.MustCompile(`(?i)^(?:\*|x+|ending(?: in)?\s+)?(\d+)$`)
+
 func getCredentials() (creds credentials, err error) {
 	// check if variable is already setup
 	accessToken := os.Getenv("ACCESS_TOKEN")
@@ -67,19 +98,74 @@ func getCredentials() (creds credentials, err error) {
 		bucketName:  os.Getenv("BUCKET_NAME"),
 		tableName:   os.Getenv("TABLE_NAME"),
 		slackURL:    os.Getenv("SLACK_URL"),
+		configFile:  os.Getenv("CONFIG_FILE"),
 	}
 	return
 
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		var err error
+		switch os.Args[1] {
+		case "shared-balances":
+			err = printSharedBalances()
+		case "reconcile":
+			err = printReconciliation(os.Args[2:])
+		default:
+			err = fmt.Errorf("unknown command %q", os.Args[1])
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 	lambda.Start(HandleLambdaEvent)
 }
 
+// printSharedBalances prints how much each person in the shared rules owes
+func printSharedBalances() error {
+	credentials, err := getCredentials()
+	if err != nil {
+		return err
+	}
+	config, err := loadConfig(credentials.configFile)
+	if err != nil {
+		return err
+	}
+
+	client := newYnabClient(credentials.accessToken, time.Time{})
+	var budgets []*ynabbudget.Summary
+	err = client.call("get budgets", func() (err error) {
+		budgets, err = client.Budget().GetBudgets()
+		return
+	})
+	if err != nil {
+		return err
+	}
+
+	balances, err := sharedBalances(client, budgets, config.SharedRules)
+	if err != nil {
+		return err
+	}
+	fmt.Print(formatBalances(balances))
+	return nil
+}
+
 type SlackRequestBody struct {
 	Text string `json:"text"`
 }
 
+// notify posts an informational message to Slack
+func notify(message string) {
+	creds, _ := getCredentials()
+	log.Print(message)
+	serr := SendSlackNotification(creds.slackURL, message)
+	if serr != nil {
+		log.Printf("Could not send Slack notification: %v", serr)
+	}
+}
+
 func notifyError(message string, err error) {
 	creds, _ := getCredentials()
 	errorString := fmt.Sprintf("Error from YNAB Importer - %s: %s", message, err.Error())
@@ -90,16 +176,35 @@ func notifyError(message string, err error) {
 	}
 }
 
-func HandleLambdaEvent(event events.DynamoDBEvent) error {
+func HandleLambdaEvent(ctx context.Context, event events.DynamoDBEvent) error {
 
 	credentials, err := getCredentials()
 	if err != nil {
 		notifyError("Missing ynab access token", err)
 		return err
 	}
-	client := ynab.NewClient(credentials.accessToken)
 
-	budgets, err := client.Budget().GetBudgets()
+	config, err := loadConfig(credentials.configFile)
+	if err != nil {
+		notifyError("Could not read config file", err)
+		return err
+	}
+
+	// Leave enough time to retry rate limited requests before Lambda stops us
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(10 * time.Minute)
+	}
+	client := newYnabClient(credentials.accessToken, deadline)
+	defer func() {
+		log.Print(client.summary())
+	}()
+
+	var budgets []*ynabbudget.Summary
+	err = client.call("get budgets", func() (err error) {
+		budgets, err = client.Budget().GetBudgets()
+		return
+	})
 	if err != nil {
 		notifyError("Could not retreive list of budgets", err)
 		return err
@@ -121,30 +226,79 @@ func HandleLambdaEvent(event events.DynamoDBEvent) error {
 				notifyError("Failed unmashalling DynamoDB record", err)
 				return err
 			}
+			if dynamoTransaction.Type == transactionReceipt {
+				return handleReceipt(client, dynamoclient, accounts, dynamoTransaction.MessageID, config)
+			}
 
-			budgetAccount, err := getAccountID(accounts, dynamoTransaction.LastDigits)
+			budgetAccount, err := getTransactionAccount(accounts, dynamoTransaction, config.Wallets)
 			if err != nil {
 				notifyError("Could not find correct account", err)
 				return err
 			}
 
-			payload, err := getPayload(dynamoTransaction, budgetAccount)
+			var payload ynabtransaction.PayloadTransaction
+			var subtransactions []subTransaction
+			var receipt *receiptRecord
+			var shared *sharedRule
+			switch dynamoTransaction.Type {
+			case transactionPayment:
+				payload, err = preparePayment(client, config, dynamoTransaction, budgetAccount, accounts)
+			case transactionRefund:
+				payload, err = prepareRefund(client, config, dynamoTransaction, budgetAccount)
+			default:
+				receipt, err = findReceipt(dynamoclient, dynamoTransaction, config.Receipts)
+				if err != nil {
+					// Not fatal. Post it without the receipt details.
+					log.Printf("Could not look for a receipt: %v", err)
+				}
+				payload, subtransactions, shared, err = preparePayload(client, config, dynamoTransaction, budgetAccount, receipt)
+			}
+			if isDeferred(err) {
+				notifyError("YNAB unavailable or rate limited. Deferring transaction", err)
+				return err
+			}
 			if err != nil {
 				notifyError("Error getting payload", err)
 				return err
 			}
-			err = postTransactionToAccount(client, budgetAccount, payload)
+
+			posted, err := postOrUpdate(client, config, dynamoTransaction, budgetAccount, payload, subtransactions)
+			if isDeferred(err) {
+				// Keep the record. Returning an error makes the stream retry it later.
+				notifyError("YNAB unavailable or rate limited. Deferring transaction", err)
+				return err
+			}
 			deleteS3 := true
 			if err != nil {
 				notifyError("Error posting payload", err)
 				deleteS3 = false
 			}
-			// Still delete in case of failure. Dynamo reprocesses until it succeeds.
-			err = deleteDynamoRecord(dynamoclient, dynamoTransaction.MessageID)
+			if deleteS3 && dynamoTransaction.Source == sourceBackfill {
+				err = expireDynamoRecord(dynamoclient, dynamoTransaction.MessageID, time.Now().Add(backfillRecordTTL))
+			} else {
+				// Still delete in case of a permanent failure. It would never succeed.
+				err = deleteDynamoRecord(dynamoclient, dynamoTransaction.MessageID)
+			}
 			if err != nil {
 				notifyError("Could not delete record", err)
 				return err
 			}
+			if shared != nil && posted && deleteS3 {
+				balance, err := sharedBalance(client, budgetAccount.budgetID, shared)
+				if err != nil {
+					log.Printf("Could not get balance owed by %s: %v", shared.Person, err)
+				} else {
+					notify(fmt.Sprintf("YNAB Importer - %s now owes $%.2f", shared.Person, float64(balance)/1000))
+				}
+			}
+			// The receipt was merged into this charge
+			if receipt != nil && posted && deleteS3 {
+				err = deleteDynamoRecord(dynamoclient, receipt.MessageID)
+				if err != nil {
+					notifyError("Could not delete receipt record", err)
+					return err
+				}
+			}
 			// Only delete from S3 if successfully posted transaction. I want to see failed messages.
 			if deleteS3 {
 				s3Client, err := createS3Client(region)
@@ -157,6 +311,13 @@ func HandleLambdaEvent(event events.DynamoDBEvent) error {
 					notifyError("Could not delete s3 bucket object", err)
 					return err
 				}
+				if receipt != nil && posted {
+					err = deleteS3Object(s3Client, receipt.MessageID)
+					if err != nil {
+						notifyError("Could not delete receipt s3 bucket object", err)
+						return err
+					}
+				}
 			}
 			return nil
 		}
@@ -184,15 +345,44 @@ func unmarshallDynamoRecord(record map[string]events.DynamoDBAttributeValue) (re
 		Date:       record["Date"].String(),
 		Amount:     float32(dynamoAmount),
 		Merchant:   record["Merchant"].String(),
+		Parser:     optionalString(record, "Parser"),
+		Time:       optionalString(record, "Time"),
+		Currency:   optionalString(record, "Currency"),
+		Type:       optionalString(record, "Type"),
+		Memo:       optionalString(record, "Memo"),
+		Wallet:     optionalString(record, "Wallet"),
+		Source:     optionalString(record, "Source"),
+		Settled:    optionalBool(record, "Settled"),
 	}
 	return
 }
 
-func getAccounts(client ynab.ClientServicer, budgets []*ynabbudget.Summary) ([]budgetAccount, error) {
+// Attributes added after the first release may be missing from older records
+func optionalString(record map[string]events.DynamoDBAttributeValue, name string) string {
+	value, ok := record[name]
+	if !ok || value.DataType() != events.DataTypeString {
+		return ""
+	}
+	return value.String()
+}
+
+func optionalBool(record map[string]events.DynamoDBAttributeValue, name string) bool {
+	value, ok := record[name]
+	return ok && value.DataType() == events.DataTypeBoolean && value.Boolean()
+}
+
+func getAccounts(client *ynabClient, budgets []*ynabbudget.Summary) ([]budgetAccount, error) {
 	var budgetAccounts []budgetAccount
 
 	for _, budget := range budgets {
-		accounts, err := client.Account().GetAccounts(budget.ID)
+		var accounts []*ynabaccount.Account
+		err := client.call("get accounts", func() (err error) {
+			accounts, err = client.Account().GetAccounts(budget.ID)
+			return
+		})
+		if isDeferred(err) {
+			return nil, err
+		}
 		if err != nil {
 			log.Printf("Could not retreive list of accounts for budget: " + err.Error())
 		}
@@ -208,15 +398,25 @@ func getAccounts(client ynab.ClientServicer, budgets []*ynabbudget.Summary) ([]b
 	return budgetAccounts, nil
 }
 
-func postTransactionToAccount(client ynab.ClientServicer, account budgetAccount, payloadTransaction ynabtransaction.PayloadTransaction) error {
-	_, err := client.Transaction().CreateTransaction(account.budgetID, payloadTransaction)
+func postTransactionToAccount(client *ynabClient, account budgetAccount, payloadTransaction ynabtransaction.PayloadTransaction, subtransactions []subTransaction) error {
+	create := func(payloadTransaction ynabtransaction.PayloadTransaction) error {
+		return client.call("create transaction", func() error {
+			if len(subtransactions) > 0 {
+				return createSplitTransaction(client, account.budgetID, payloadTransaction, subtransactions)
+			}
+			_, err := client.Transaction().CreateTransaction(account.budgetID, payloadTransaction)
+			return err
+		})
+	}
+
+	err := create(payloadTransaction)
 	if err != nil {
 		if strings.Contains(err.Error(), "date must not be in the future or over 5 years ago") {
 			originalDate := payloadTransaction.Date
 			newDate := originalDate.Add(time.Hour * -12)
 			payloadTransaction.Date = api.Date{newDate}
 			time.Sleep(time.Second * 10)
-			_, retryerr := client.Transaction().CreateTransaction(account.budgetID, payloadTransaction)
+			retryerr := create(payloadTransaction)
 			if retryerr != nil {
 				notifyError("Failed to post ynab transaction with 12 hour difference", retryerr)
 				return retryerr
@@ -228,12 +428,171 @@ func postTransactionToAccount(client ynab.ClientServicer, account budgetAccount,
 	return nil
 }
 
+// postOrUpdate updates the pending transaction a second alert is for, or posts a new one
+// after checking it isn't already in YNAB. It returns false when nothing was posted.
+func postOrUpdate(client *ynabClient, config posterConfig, transaction Transaction, account budgetAccount, payload ynabtransaction.PayloadTransaction, subtransactions []subTransaction) (bool, error) {
+	if isWalletCardAlert(transaction, config.Wallets) {
+		log.Printf("Skipping %s, the %s receipt posts it", transaction.MessageID, transaction.Merchant)
+		return false, nil
+	}
+
+	recent, err := getRecentTransactions(client, account, payload.Date, config)
+	if isDeferred(err) {
+		return false, err
+	}
+	if err != nil {
+		// Not fatal. Post it without the checks.
+		log.Printf("Could not retreive recent transactions: %v", err)
+	}
+
+	// A second alert for a charge we already posted only changes its amount
+	if existing := findPendingTransaction(recent, transaction, payload, config); existing != nil {
+		return true, updatePendingTransaction(client, account.budgetID, existing, payload, config.MemoMarker)
+	}
+
+	if existing := findDuplicate(recent, payload, config); existing != nil {
+		message := fmt.Sprintf("YNAB Importer - %s looks like a duplicate of %s", transaction.MessageID, describeTransaction(existing))
+		switch config.Duplicates.Action {
+		case duplicateSkip:
+			notify(message + ". Not posting it.")
+			return false, nil
+		case duplicateFlag:
+			markDuplicate(&payload, existing, config.Duplicates)
+			notify(message + ". Posting it flagged.")
+		default:
+			notify(message + ". Posting it anyway.")
+		}
+	}
+
+	payload.Memo = markMemo(payload.Memo, config.MemoMarker)
+	return true, postTransactionToAccount(client, account, payload, subtransactions)
+}
+
+// preparePayload builds the payload and fills in everything the config can add to it:
+// payee, memo, category, splits, flag and approval. Only a deferred error or a failure to
+// build the basic payload is returned. Anything else is reported and the transaction is
+// posted with less detail rather than lost. The shared rule applied to the transaction,
+// if any, is returned so its balance can be reported once it is posted.
+func preparePayload(client *ynabClient, config posterConfig, transaction Transaction, account budgetAccount, receipt *receiptRecord) (ynabtransaction.PayloadTransaction, []subTransaction, *sharedRule, error) {
+	payload, err := getPayload(transaction, account)
+	if err != nil {
+		return payload, nil, nil, err
+	}
+
+	payload.Memo, err = renderMemo(transaction, config.Memos)
+	if err != nil {
+		// Not fatal. The memo is only informational.
+		log.Printf("Could not render memo: %v", err)
+	}
+	if payload.Memo == nil && transaction.Memo != "" {
+		// e.g. the note on a Zelle payment
+		memo := truncate(transaction.Memo, maxMemoLength)
+		payload.Memo = &memo
+	}
+	if receipt != nil {
+		log.Printf("Charge %s is for receipt %s", transaction.MessageID, receipt.MessageID)
+		payload.Memo = receiptMemo(receipt, payload.Memo)
+	}
+
+	payees, err := getPayees(client, account.budgetID)
+	if isDeferred(err) {
+		return payload, nil, nil, err
+	}
+	if err != nil {
+		// Not fatal. The raw merchant name is still a usable payee.
+		log.Printf("Could not retreive list of payees: %v", err)
+	} else {
+		payload.PayeeID, payload.PayeeName = applyPayee(transaction.Merchant, payees, config)
+	}
+
+	categoryID, categoryRule, err := assignCategory(client, account.budgetID, transaction, config.CategoryRules)
+	if isDeferred(err) {
+		return payload, nil, nil, err
+	}
+	if err != nil {
+		// Post it uncategorized rather than losing it
+		notifyError("Could not assign category", err)
+	} else {
+		payload.CategoryID = categoryID
+	}
+
+	if payload.CategoryID == nil && config.History.Enabled {
+		categoryID, err := suggestCategory(client, account.budgetID, payload, config.History)
+		if isDeferred(err) {
+			return payload, nil, nil, err
+		}
+		if err != nil {
+			log.Printf("Could not suggest a category from history: %v", err)
+		} else {
+			payload.CategoryID = categoryID
+		}
+	}
+
+	var subtransactions []subTransaction
+	if receipt != nil && config.Receipts.SplitItems {
+		subtransactions, err = splitReceipt(client, account.budgetID, transaction, payload, receipt, config.CategoryRules)
+		if isDeferred(err) {
+			return payload, nil, nil, err
+		}
+		if err != nil {
+			notifyError("Could not split receipt", err)
+		}
+	}
+
+	if subtransactions == nil {
+		subtransactions, err = splitTransaction(client, account.budgetID, transaction, payload, config.SplitRules)
+		if isDeferred(err) {
+			return payload, nil, nil, err
+		}
+		if err != nil {
+			notifyError("Could not split transaction", err)
+		}
+	}
+
+	subtransactions, shared, err := shareTransaction(client, account.budgetID, transaction, payload, subtransactions, config.SharedRules)
+	if isDeferred(err) {
+		return payload, nil, nil, err
+	}
+	if err != nil {
+		notifyError("Could not share transaction", err)
+	}
+
+	subtransactions = collapseSplit(&payload, subtransactions)
+	applyPolicy(&payload, transaction, categoryRule, config.Policy)
+	return payload, subtransactions, shared, nil
+}
+
+// collapseSplit posts a split with a single part as a plain transaction, with that part's
+// category, payee and memo. With several parts YNAB assigns the split category itself.
+func collapseSplit(payload *ynabtransaction.PayloadTransaction, subtransactions []subTransaction) []subTransaction {
+	switch len(subtransactions) {
+	case 0:
+		return nil
+	case 1:
+		// e.g. someone else owes all of it
+		only := subtransactions[0]
+		payload.CategoryID = only.CategoryID
+		if only.PayeeID != nil || only.PayeeName != nil {
+			payload.PayeeID, payload.PayeeName = only.PayeeID, only.PayeeName
+		}
+		if only.Memo != nil {
+			payload.Memo = only.Memo
+		}
+		return nil
+	default:
+		payload.CategoryID = nil
+		return subtransactions
+	}
+}
+
 func getPayload(record Transaction, account budgetAccount) (payloadTransaction ynabtransaction.PayloadTransaction, err error) {
 
 	date, err := api.DateFromString(record.Date)
 
 	today := time.Now()
-	if date.Before(today.AddDate(0, 0, -3)) || date.After(today) {
+	// Live alerts are never more than a few days old, backfilled ones are
+	tooOld := record.Source != sourceBackfill && date.Before(today.AddDate(0, 0, -3))
+	if date.IsZero() || tooOld || date.After(today) {
 		log.Printf("Could not parse date. Using today's date.")
 		date = api.Date{Time: today.Add(time.Hour * -6)}
 	}
@@ -243,6 +602,9 @@ func getPayload(record Transaction, account budgetAccount) (payloadTransaction y
 	}
 
 	amount := int64(record.Amount * -1000)
+	if isInflow(record.Type) {
+		amount = -amount
+	}
 	payee := record.Merchant
 	//memo := "Imported via email"
 
@@ -257,14 +619,20 @@ func getPayload(record Transaction, account budgetAccount) (payloadTransaction y
 	return
 }
 
-// Checks accounts for the ID given. This is the last 4 digits of the CC passed in email.
-// The 4 digits must be added to the notes section of YNAB.
+// Payments, refunds and deposits add to the account
+func isInflow(transactionType string) bool {
+	return transactionType == transactionPayment || transactionType == transactionRefund || transactionType == transactionDeposit
+}
+
+// Checks accounts for the ID given. This is the last 4 digits of the CC or account number passed in email.
+// The digits must be added to the notes section of YNAB. A checking account can list its account
+// number and debit card digits separated by commas, e.g. "4567, 8910". Entries with other text,
+// like "opened 2019", are ignored so they can't claim another card's alerts.
 func getAccountID(accounts []budgetAccount, digits int) (budgetAccount, error) {
 
-	check := strconv.Itoa(digits)
 	for _, ynabAccount := range accounts {
-		if ynabAccount.account.Note != nil {
-			if *ynabAccount.account.Note == check {
+		for _, n := range noteDigits(ynabAccount.account.Note) {
+			if n == digits {
 				return ynabAccount, nil
 			}
 		}
@@ -273,6 +641,25 @@ func getAccountID(accounts []budgetAccount, digits int) (budgetAccount, error) {
 	return budgetAccount{}, errors.New("could not find account matching the given digits")
 }
 
+// noteDigits returns the numbers listed in an account note. They are numbers so "0123" in the
+// note is 123 in the record.
+func noteDigits(note *string) []int {
+	if note == nil {
+		return nil
+	}
+	var digits []int
+	for _, entry := range strings.Split(*note, ",") {
+		match := accountNumber.FindStringSubmatch(strings.TrimSpace(entry))
+		if match == nil {
+			continue
+		}
+		if n, err := strconv.Atoi(match[1]); err == nil {
+			digits = append(digits, n)
+		}
+	}
+	return digits
+}
+
 func getDynamoClient(region string) *dynamodb.DynamoDB {
 	config := &aws.Config{
 		Region: aws.String(region),
@@ -360,6 +747,34 @@ func deleteDynamoRecord(client *dynamodb.DynamoDB, messageID string) error {
 	return nil
 }
 
+// expireDynamoRecord leaves the record for DynamoDB to remove at expires. Only new records are posted,
+// so it isn't posted again.
+func expireDynamoRecord(client *dynamodb.DynamoDB, messageID string, expires time.Time) error {
+
+	creds, _ := getCredentials()
+	key, err := getDynamoKey(messageID)
+	if err != nil {
+		log.Printf("Error getting key from messageid: %v", err)
+		return err
+	}
+
+	input := &dynamodb.UpdateItemInput{
+		Key:              key,
+		TableName:        aws.String(creds.tableName),
+		UpdateExpression: aws.String("SET ExpiresAt = :expires"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":expires": {N: aws.String(strconv.FormatInt(expires.Unix(), 10))},
+		},
+	}
+
+	_, err = client.UpdateItem(input)
+	if err != nil {
+		fmt.Println(err.Error())
+		return err
+	}
+	return nil
+}
+
 // Delete object from S3. Run here because S3 objects should remain unless transaction was posted successfully.
 func deleteS3Object(s3Client *s3.S3, key string) error {
 
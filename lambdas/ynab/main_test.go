@@ -93,6 +93,59 @@ var _ = Describe("Handle DynamoDBEvent", func() {
 			Expect(payload).To(Equal(expectedPayloadTransaction))
 		})
 
+		It("posts deposits as inflows", func() {
+			dynamoTransaction, err := unmarshallDynamoRecord(image)
+			dynamoTransaction.Type = transactionDeposit
+			payload, err := getPayload(dynamoTransaction, fakeBudgetAccount)
+			Expect(err).To(BeNil())
+			Expect(payload.Amount).To(Equal(int64(56780)))
+		})
+
+		It("keeps the date of backfilled emails", func() {
+			dynamoTransaction, err := unmarshallDynamoRecord(image)
+			dynamoTransaction.Source = sourceBackfill
+			payload, err := getPayload(dynamoTransaction, fakeBudgetAccount)
+			Expect(err).To(BeNil())
+			Expect(payload.Date.Format("2006-01-02")).To(Equal("2020-10-13"))
+		})
+
+		It("finds accounts by the numbers listed in the note", func() {
+			card, checking, other := "0123", "4567, ending in 8910", "Opened 2019, call 800 555 1212"
+			accounts := []budgetAccount{
+				{budgetID: "budget", account: &account.Account{ID: "other", Note: &other}},
+				{budgetID: "budget", account: &account.Account{ID: "card", Note: &card}},
+				{budgetID: "budget", account: &account.Account{ID: "checking", Note: &checking}},
+			}
+			found, err := getAccountID(accounts, 123)
+			Expect(err).To(BeNil())
+			Expect(found.account.ID).To(Equal("card"))
+			found, err = getAccountID(accounts, 8910)
+			Expect(err).To(BeNil())
+			Expect(found.account.ID).To(Equal("checking"))
+			_, err = getAccountID(accounts, 1111)
+			Expect(err).To(HaveOccurred())
+			_, err = getAccountID(accounts, 2019)
+			Expect(err).To(HaveOccurred())
+			_, err = getAccountID(accounts, 1212)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("finds accounts whose note has more than four digits", func() {
+			// Notes from before entries were parsed only held the number
+			amex, citi := "31005", "x0012345"
+			accounts := []budgetAccount{
+				{budgetID: "budget", account: &account.Account{ID: "amex", Note: &amex}},
+				{budgetID: "budget", account: &account.Account{ID: "citi", Note: &citi}},
+			}
+			found, err := getAccountID(accounts, 31005)
+			Expect(err).To(BeNil())
+			Expect(found.account.ID).To(Equal("amex"))
+			found, err = getAccountID(accounts, 12345)
+			Expect(err).To(BeNil())
+			Expect(found.account.ID).To(Equal("citi"))
+			Expect(noteDigits(&amex)).To(Equal([]int{31005}))
+		})
+
 		//It("gets duplicate correctly", func() {
 		//	err := getDuplicate(dynamoclient, "aau75dockiceclf9olvjrgumgli2r40nn1gf7j81")
 		//	Expect(err).To(BeNil())
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// YNAB rejects memos longer than this
+const maxMemoLength = 200
+
+// memoTemplate is a Go text/template rendered into the memo of matching transactions.
+// A template without cards or parsers applies to every transaction.
+type memoTemplate struct {
+	Cards    []int    `json:"cards"`
+	Parsers  []string `json:"parsers"`
+	Template string   `json:"template"`
+
+	compiled *template.Template
+}
+
+// memoData is what a memo template can use, e.g. "{{.Bank}} *{{.LastDigits}} {{.Merchant}}"
+type memoData struct {
+	MessageID  string
+	Merchant   string // raw merchant descriptor from the alert
+	LastDigits int
+	Bank       string // name of the parser that read the alert
+	Date       string
+	Time       string
+	Amount     string // amount as it appeared in the alert, e.g. "12.34"
+	Currency   string
+	Memo       string // note that came with the alert, e.g. on a Zelle payment
+}
+
+func compileMemoTemplates(memos []memoTemplate) error {
+	for i := range memos {
+		compiled, err := template.New(fmt.Sprintf("memo %d", i+1)).Parse(memos[i].Template)
+		if err != nil {
+			return fmt.Errorf("invalid memo template %q: %v", memos[i].Template, err)
+		}
+		memos[i].compiled = compiled
+	}
+	return nil
+}
+
+// renderMemo uses the first template matching the transaction's card or parser.
+// It returns nil when no template applies.
+func renderMemo(transaction Transaction, memos []memoTemplate) (*string, error) {
+	for _, memo := range memos {
+		if !memo.matches(transaction) {
+			continue
+		}
+
+		data := memoData{
+			MessageID:  transaction.MessageID,
+			Merchant:   transaction.Merchant,
+			LastDigits: transaction.LastDigits,
+			Bank:       transaction.Parser,
+			Date:       transaction.Date,
+			Time:       transaction.Time,
+			Amount:     fmt.Sprintf("%.2f", transaction.Amount),
+			Currency:   transaction.Currency,
+			Memo:       transaction.Memo,
+		}
+		var buf bytes.Buffer
+		if err := memo.compiled.Execute(&buf, data); err != nil {
+			return nil, err
+		}
+
+		text := truncate(strings.Join(strings.Fields(buf.String()), " "), maxMemoLength)
+		if text == "" {
+			return nil, nil
+		}
+		return &text, nil
+	}
+	return nil, nil
+}
+
+func (m memoTemplate) matches(transaction Transaction) bool {
+	if len(m.Cards) > 0 {
+		found := false
+		for _, card := range m.Cards {
+			found = found || card == transaction.LastDigits
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(m.Parsers) > 0 {
+		found := false
+		for _, parser := range m.Parsers {
+			found = found || strings.EqualFold(parser, transaction.Parser)
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// markMemo adds the marker to a memo, shortening the memo to make room for it.
+// Reconciliation and pending updates use the marker to find what we posted.
+func markMemo(memo *string, marker string) *string {
+	if marker == "" || hasMarker(memo, marker) {
+		return memo
+	}
+	text := marker
+	if memo != nil && *memo != "" {
+		text = truncate(*memo, maxMemoLength-len([]rune(marker))-1) + " " + marker
+	}
+	return &text
+}
+
+func hasMarker(memo *string, marker string) bool {
+	return marker != "" && memo != nil && strings.Contains(*memo, marker)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Memo templates", func() {
+
+	var (
+		memos       []memoTemplate
+		transaction Transaction
+	)
+
+	BeforeEach(func() {
+		memos = []memoTemplate{
+			{Cards: []int{2345}, Template: "Costco card {{.Time}}"},
+			{Parsers: []string{"Chase"}, Template: "{{.Bank}} *{{.LastDigits}} {{.Merchant}} {{.Amount}} {{.Currency}}"},
+		}
+		Expect(compileMemoTemplates(memos)).To(Succeed())
+
+		transaction = Transaction{
+			MessageID:  "asdfasdfasdfasdf",
+			LastDigits: 1234,
+			Date:       "2020-10-15",
+			Amount:     109.00,
+			Merchant:   "Test Mer\\chant.com",
+			Parser:     "Chase",
+			Time:       "11:27 AM",
+			Currency:   "USD",
+		}
+	})
+
+	Context("When rendering a memo, ", func() {
+
+		It("uses the first template for the card or parser", func() {
+			memo, err := renderMemo(transaction, memos)
+			Expect(err).To(BeNil())
+			Expect(*memo).To(Equal("Chase *1234 Test Mer\\chant.com 109.00 USD"))
+		})
+
+		It("returns nil when no template applies", func() {
+			transaction.Parser = "Bank of America"
+			memo, err := renderMemo(transaction, memos)
+			Expect(err).To(BeNil())
+			Expect(memo).To(BeNil())
+		})
+
+		It("truncates to the YNAB memo limit", func() {
+			transaction.Merchant = strings.Repeat("é", 300)
+			memo, _ := renderMemo(transaction, memos)
+			Expect([]rune(*memo)).To(HaveLen(maxMemoLength))
+		})
+
+		It("rejects invalid templates", func() {
+			Expect(compileMemoTemplates([]memoTemplate{{Template: "{{.Bank"}})).NotTo(Succeed())
+		})
+	})
+
+	Context("When marking a memo, ", func() {
+
+		It("adds the marker once", func() {
+			memo := "Chase *1234"
+			Expect(*markMemo(&memo, "via email")).To(Equal("Chase *1234 via email"))
+			memo = "Imported via email"
+			Expect(*markMemo(&memo, "via email")).To(Equal("Imported via email"))
+			Expect(*markMemo(nil, "via email")).To(Equal("via email"))
+		})
+
+		It("keeps the marker when the memo is too long", func() {
+			memo := strings.Repeat("é", maxMemoLength)
+			marked := *markMemo(&memo, "via email")
+			Expect([]rune(marked)).To(HaveLen(maxMemoLength))
+			Expect(marked).To(HaveSuffix(" via email"))
+		})
+	})
+
+})
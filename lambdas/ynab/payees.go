@@ -0,0 +1,201 @@
+package main
+
+import (
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	ynabpayee "go.bmvs.io/ynab/api/payee"
+)
+
+// YNAB rejects payee names longer than this
+const maxPayeeNameLength = 50
+
+// Payees rarely change. Cache them so a warm container doesn't spend a request on every transaction.
+const payeeCacheTTL = time.Hour
+
+var payeeCache = struct {
+	sync.Mutex
+	budgets map[string]cachedPayees
+}{budgets: map[string]cachedPayees{}}
+
+type cachedPayees struct {
+	payees    []*ynabpayee.Payee
+	fetchedAt time.Time
+}
+
+// Payees YNAB creates itself. Transactions should never be posted to these.
+var internalPayees = map[string]bool{
+	"Starting Balance":                  true,
+	"Manual Balance Adjustment":         true,
+	"Reconciliation Balance Adjustment": true,
+}
+
+var (
+	// Processor prefixes like "SQ *", "TST* " or "PAYPAL *"
+	descriptorPrefix = regexp.MustCompile(`^(?i)(sq|tst|sp|pp|paypal|pos|dd|ic|in)\s?\*\s*`)
+	// Store numbers and reference numbers like "#1234" or "0123456"
+	descriptorNumbers = regexp.MustCompile(`#\s*\d+|\b\d{3,}\b`)
+	// Trailing state code, e.g. the "WA" in "STARBUCKS SEATTLE WA"
+	descriptorState = regexp.MustCompile(`\s+(AL|AK|AZ|AR|CA|CO|CT|DC|DE|FL|GA|HI|ID|IL|IN|IA|KS|KY|LA|ME|MD|MA|MI|MN|MS|MO|MT|NE|NV|NH|NJ|NM|NY|NC|ND|OH|OK|OR|PA|RI|SC|SD|TN|TX|UT|VT|VA|WA|WV|WI|WY)$`)
+	nonAlphanumeric = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+func getPayees(client *ynabClient, budgetID string) ([]*ynabpayee.Payee, error) {
+	payeeCache.Lock()
+	defer payeeCache.Unlock()
+
+	cached, ok := payeeCache.budgets[budgetID]
+	if ok && time.Since(cached.fetchedAt) < payeeCacheTTL {
+		return cached.payees, nil
+	}
+
+	var payees []*ynabpayee.Payee
+	err := client.call("get payees", func() (err error) {
+		payees, err = client.Payee().GetPayees(budgetID)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	payeeCache.budgets[budgetID] = cachedPayees{payees: payees, fetchedAt: time.Now()}
+	return payees, nil
+}
+
+// applyPayee posts to an existing payee when the merchant matches one confidently, so YNAB
+// can apply the category it remembers for that payee. Otherwise a cleaned up name is used.
+func applyPayee(merchant string, payees []*ynabpayee.Payee, config posterConfig) (payeeID *string, payeeName *string) {
+	name := cleanMerchant(merchant)
+	if alias, ok := findAlias(merchant, config.PayeeAliases); ok {
+		name = alias
+	}
+
+	payee, score := matchPayee(name, payees)
+	if payee != nil && score >= config.PayeeMatchThreshold {
+		log.Printf("Matched merchant %q to payee %q (score %.2f)", merchant, payee.Name, score)
+		return &payee.ID, nil
+	}
+
+	name = truncate(name, maxPayeeNameLength)
+	return nil, &name
+}
+
+// Aliases are matched as case insensitive substrings of the raw descriptor.
+// The longest matching alias wins so specific aliases can override general ones.
+func findAlias(merchant string, aliases map[string]string) (string, bool) {
+	lower := strings.ToLower(merchant)
+	best := ""
+	for pattern := range aliases {
+		if strings.Contains(lower, strings.ToLower(pattern)) && len(pattern) > len(best) {
+			best = pattern
+		}
+	}
+	if best == "" {
+		return "", false
+	}
+	return aliases[best], true
+}
+
+// cleanMerchant strips the noise banks add to card descriptors
+func cleanMerchant(merchant string) string {
+	name := strings.TrimSpace(merchant)
+	name = descriptorPrefix.ReplaceAllString(name, "")
+	name = descriptorNumbers.ReplaceAllString(name, "")
+	name = strings.Join(strings.Fields(name), " ")
+	name = descriptorState.ReplaceAllString(name, "")
+	name = strings.Trim(name, " -*#")
+
+	if name == "" {
+		return strings.TrimSpace(merchant)
+	}
+	if strings.ToUpper(name) == name {
+		name = strings.Title(strings.ToLower(name))
+	}
+	return name
+}
+
+// matchPayee returns the payee most similar to name and its score between 0 and 1
+func matchPayee(name string, payees []*ynabpayee.Payee) (*ynabpayee.Payee, float64) {
+	var best *ynabpayee.Payee
+	bestScore := 0.0
+	for _, payee := range payees {
+		// Never match transfer payees or YNAB's own payees like "Starting Balance"
+		if payee.Deleted || payee.TransferAccountID != nil || internalPayees[payee.Name] {
+			continue
+		}
+		score := similarity(name, payee.Name)
+		if score > bestScore {
+			best = payee
+			bestScore = score
+		}
+	}
+	return best, bestScore
+}
+
+// similarity compares two names. An exact match after normalising scores 1, a payee whose
+// words all appear in the merchant scores 0.9, anything else is scored on shared bigrams.
+func similarity(a, b string) float64 {
+	na, nb := normalizeName(a), normalizeName(b)
+	if na == "" || nb == "" {
+		return 0
+	}
+	if na == nb {
+		return 1
+	}
+	if containsWords(na, nb) {
+		return 0.9
+	}
+	return diceCoefficient(strings.Replace(na, " ", "", -1), strings.Replace(nb, " ", "", -1))
+}
+
+func normalizeName(name string) string {
+	name = nonAlphanumeric.ReplaceAllString(strings.ToLower(name), " ")
+	return strings.TrimSpace(name)
+}
+
+// containsWords reports whether every word of short (at least 3 letters long) is in long
+func containsWords(long, short string) bool {
+	if len(short) < 3 {
+		return false
+	}
+	words := map[string]bool{}
+	for _, word := range strings.Fields(long) {
+		words[word] = true
+	}
+	for _, word := range strings.Fields(short) {
+		if !words[word] {
+			return false
+		}
+	}
+	return true
+}
+
+func diceCoefficient(a, b string) float64 {
+	if len(a) < 2 || len(b) < 2 {
+		return 0
+	}
+	bigrams := map[string]int{}
+	for i := 0; i < len(a)-1; i++ {
+		bigrams[a[i:i+2]]++
+	}
+	shared := 0
+	for i := 0; i < len(b)-1; i++ {
+		if bigrams[b[i:i+2]] > 0 {
+			bigrams[b[i:i+2]]--
+			shared++
+		}
+	}
+	return float64(2*shared) / float64(len(a)+len(b)-2)
+}
+
+// truncate shortens s to at most n characters without splitting a multi-byte character
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return strings.TrimSpace(string(runes[:n]))
+}
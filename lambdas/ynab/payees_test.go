@@ -0,0 +1,62 @@
+package main
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	ynabpayee "go.bmvs.io/ynab/api/payee"
+)
+
+var _ = Describe("Match payees", func() {
+
+	var (
+		payees []*ynabpayee.Payee
+		config posterConfig
+	)
+
+	BeforeEach(func() {
+		transferAccount := "checkingaccountid"
+		payees = []*ynabpayee.Payee{
+			{ID: "netflixid", Name: "Netflix"},
+			{ID: "wholefoodsid", Name: "Whole Foods"},
+			{ID: "amazonid", Name: "Amazon"},
+			{ID: "transferid", Name: "Transfer : Checking", TransferAccountID: &transferAccount},
+			{ID: "startingid", Name: "Starting Balance"},
+		}
+		config = defaultConfig()
+		config.PayeeAliases = map[string]string{"AMZN Mktp": "Amazon"}
+	})
+
+	Context("When cleaning merchant descriptors, ", func() {
+
+		It("removes processor prefixes, store numbers and states", func() {
+			Expect(cleanMerchant("SQ *BLUE BOTTLE COFFEE #1234 OAKLAND CA")).To(Equal("Blue Bottle Coffee Oakland"))
+			Expect(cleanMerchant("Test Mer\\chant.com")).To(Equal("Test Mer\\chant.com"))
+		})
+	})
+
+	Context("When matching a merchant, ", func() {
+
+		It("uses the payee ID for a confident match", func() {
+			payeeID, payeeName := applyPayee("NETFLIX.COM 8665797172 CA", payees, config)
+			Expect(payeeName).To(BeNil())
+			Expect(*payeeID).To(Equal("netflixid"))
+		})
+
+		It("uses aliases before matching", func() {
+			payeeID, _ := applyPayee("AMZN Mktp US*2K3LM4N5", payees, config)
+			Expect(*payeeID).To(Equal("amazonid"))
+		})
+
+		It("falls back to a cleaned up payee name", func() {
+			payeeID, payeeName := applyPayee("TST* NEW RESTAURANT 00123", payees, config)
+			Expect(payeeID).To(BeNil())
+			Expect(*payeeName).To(Equal("New Restaurant"))
+		})
+
+		It("never matches transfer or internal payees", func() {
+			payee, _ := matchPayee("Starting Balance", payees[3:])
+			Expect(payee).To(BeNil())
+		})
+	})
+
+})
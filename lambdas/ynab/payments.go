@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	ynabpayee "go.bmvs.io/ynab/api/payee"
+	ynabtransaction "go.bmvs.io/ynab/api/transaction"
+)
+
+// paymentConfig says which account card payments are made from
+type paymentConfig struct {
+	// Name of the checking account payments come from
+	FundingAccount string `json:"fundingAccount"`
+	// Funding account for specific cards, by last digits
+	CardFunding map[int]string `json:"cardFunding"`
+}
+
+func (p paymentConfig) fundingAccount(lastDigits int) string {
+	if name, ok := p.CardFunding[lastDigits]; ok {
+		return name
+	}
+	return p.FundingAccount
+}
+
+// preparePayment builds a transfer from the funding account to the card. YNAB creates the
+// matching outflow in the funding account, so the payment isn't counted as spending.
+func preparePayment(client *ynabClient, config posterConfig, transaction Transaction, account budgetAccount, accounts []budgetAccount) (ynabtransaction.PayloadTransaction, error) {
+	payload, err := getPayload(transaction, account)
+	if err != nil {
+		return payload, err
+	}
+	payload.PayeeName = nil
+
+	name := config.Payments.fundingAccount(transaction.LastDigits)
+	if name == "" {
+		return payload, fmt.Errorf("no funding account configured for payments to card %d", transaction.LastDigits)
+	}
+	funding, err := findAccountByName(accounts, account.budgetID, name)
+	if err != nil {
+		return payload, err
+	}
+
+	payees, err := getPayees(client, account.budgetID)
+	if err != nil {
+		return payload, err
+	}
+	transferPayee := findTransferPayee(payees, funding.account.ID)
+	if transferPayee == nil {
+		return payload, fmt.Errorf("could not find the transfer payee for account %q", name)
+	}
+	log.Printf("Posting payment %s as a transfer from %s", transaction.MessageID, name)
+	payload.PayeeID = &transferPayee.ID
+
+	payload.Memo, err = renderMemo(transaction, config.Memos)
+	if err != nil {
+		log.Printf("Could not render memo: %v", err)
+	}
+	return payload, nil
+}
+
+// findAccountByName looks for an open account in the given budget, or any budget when it is empty.
+// Transfers can't cross budgets.
+func findAccountByName(accounts []budgetAccount, budgetID, name string) (budgetAccount, error) {
+	for _, account := range accounts {
+		if budgetID != "" && account.budgetID != budgetID {
+			continue
+		}
+		if !account.account.Closed && strings.EqualFold(account.account.Name, name) {
+			return account, nil
+		}
+	}
+	return budgetAccount{}, fmt.Errorf("could not find account %q", name)
+}
+
+// Every account has a payee YNAB uses for transfers to it
+func findTransferPayee(payees []*ynabpayee.Payee, accountID string) *ynabpayee.Payee {
+	for _, payee := range payees {
+		if !payee.Deleted && payee.TransferAccountID != nil && *payee.TransferAccountID == accountID {
+			return payee
+		}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	ynabaccount "go.bmvs.io/ynab/api/account"
+	ynabpayee "go.bmvs.io/ynab/api/payee"
+)
+
+var _ = Describe("Card payments", func() {
+
+	var (
+		payments paymentConfig
+		accounts []budgetAccount
+	)
+
+	BeforeEach(func() {
+		payments = paymentConfig{
+			FundingAccount: "Checking",
+			CardFunding:    map[int]string{5678: "Joint Checking"},
+		}
+		accounts = []budgetAccount{
+			{budgetID: "other", account: &ynabaccount.Account{ID: "otherchecking", Name: "Checking"}},
+			{budgetID: "budget", account: &ynabaccount.Account{ID: "closed", Name: "Checking", Closed: true}},
+			{budgetID: "budget", account: &ynabaccount.Account{ID: "checking", Name: "Checking"}},
+		}
+	})
+
+	It("uses the card's funding account when there is one", func() {
+		Expect(payments.fundingAccount(5678)).To(Equal("Joint Checking"))
+		Expect(payments.fundingAccount(1234)).To(Equal("Checking"))
+	})
+
+	It("finds the open funding account in the card's budget", func() {
+		account, err := findAccountByName(accounts, "budget", "checking")
+		Expect(err).To(BeNil())
+		Expect(account.account.ID).To(Equal("checking"))
+
+		_, err = findAccountByName(accounts, "budget", "Savings")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("finds the transfer payee for the funding account", func() {
+		checking, savings := "checking", "savings"
+		payees := []*ynabpayee.Payee{
+			{ID: "grocer", Name: "Grocer"},
+			{ID: "tosavings", Name: "Transfer : Savings", TransferAccountID: &savings},
+			{ID: "tochecking", Name: "Transfer : Checking", TransferAccountID: &checking},
+		}
+		Expect(findTransferPayee(payees, "checking").ID).To(Equal("tochecking"))
+		Expect(findTransferPayee(payees, "brokerage")).To(BeNil())
+	})
+
+})
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	ynabtransaction "go.bmvs.io/ynab/api/transaction"
+)
+
+// pendingConfig controls updating a transaction when a second alert arrives for the
+// same charge, e.g. a restaurant alert for the authorization and another once the tip posts.
+type pendingConfig struct {
+	Enabled bool `json:"enabled"`
+	// Merchants whose charges change after the authorization, e.g. restaurants and gas.
+	// Required, optionally limited further to some cards or parsers.
+	ruleConditions
+	// How many days back to look for the original charge
+	WindowDays int `json:"windowDays"`
+	// How far (in percent) the final amount may be from the authorization
+	MaxChangePercent float64 `json:"maxChangePercent"`
+}
+
+func defaultPendingConfig() pendingConfig {
+	return pendingConfig{
+		WindowDays:       3,
+		MaxChangePercent: 30,
+	}
+}
+
+func (p *pendingConfig) compile() error {
+	// A second purchase from the same store is far more common than a changed amount
+	if p.Enabled && p.Merchant == "" {
+		return fmt.Errorf("needs a merchant, e.g. \"restaurant|grill|shell\"")
+	}
+	return p.ruleConditions.compile()
+}
+
+// findPendingTransaction looks through recent transactions in the account for an uncleared
+// one we posted from the same merchant with a different, but close, amount. Only alerts
+// saying they are for the final amount of an earlier authorization are checked.
+func findPendingTransaction(recent []*ynabtransaction.Transaction, transaction Transaction, payload ynabtransaction.PayloadTransaction, config posterConfig) *ynabtransaction.Transaction {
+	pending := config.Pending
+	// Only card charges get a second alert
+	if !pending.Enabled || !transaction.Settled || transaction.Type != transactionPurchase {
+		return nil
+	}
+	if _, ok := pending.matches(transaction); !ok {
+		return nil
+	}
+
+	since := payload.Date.AddDate(0, 0, -pending.WindowDays)
+	var candidates []*ynabtransaction.Transaction
+	for _, existing := range recent {
+		if !existing.Date.Before(since) {
+			candidates = append(candidates, existing)
+		}
+	}
+	return matchPending(candidates, payload, pending, config.MemoMarker, config.PayeeMatchThreshold)
+}
+
+func matchPending(transactions []*ynabtransaction.Transaction, payload ynabtransaction.PayloadTransaction, pending pendingConfig, marker string, threshold float64) *ynabtransaction.Transaction {
+	var best *ynabtransaction.Transaction
+	for _, existing := range transactions {
+		if existing.Deleted || existing.Cleared != ynabtransaction.ClearingStatusUncleared {
+			continue
+		}
+		// Never change what was entered by hand or imported by the bank
+		if !hasMarker(existing.Memo, marker) {
+			continue
+		}
+		// Changing the amount of a split would break it
+		if len(existing.SubTransactions) > 0 || existing.TransferAccountID != nil {
+			continue
+		}
+		if existing.Amount == payload.Amount || !sameSign(existing.Amount, payload.Amount) {
+			continue
+		}
+		change := math.Abs(float64(payload.Amount-existing.Amount)) / math.Abs(float64(existing.Amount)) * 100
+		if change > pending.MaxChangePercent {
+			continue
+		}
+		if existing.Date.After(payload.Date.Time) || !samePayee(existing, payload, threshold) {
+			continue
+		}
+		// Prefer the most recent charge if there is more than one
+		if best == nil || existing.Date.After(best.Date.Time) {
+			best = existing
+		}
+	}
+	return best
+}
+
+func sameSign(a, b int64) bool {
+	return (a < 0) == (b < 0)
+}
+
+func samePayee(existing *ynabtransaction.Transaction, payload ynabtransaction.PayloadTransaction, threshold float64) bool {
+	if existing.PayeeID != nil && payload.PayeeID != nil {
+		return *existing.PayeeID == *payload.PayeeID
+	}
+	if existing.PayeeName != nil && payload.PayeeName != nil {
+		return similarity(*payload.PayeeName, *existing.PayeeName) >= threshold
+	}
+	return false
+}
+
+// updatePendingTransaction replaces the amount of the original transaction and notes the
+// change in its memo, keeping everything else as it is in YNAB.
+func updatePendingTransaction(client *ynabClient, budgetID string, existing *ynabtransaction.Transaction, payload ynabtransaction.PayloadTransaction, marker string) error {
+	trail := fmt.Sprintf("Updated from %.2f to %.2f on %s", float64(-existing.Amount)/1000, float64(-payload.Amount)/1000, time.Now().Format("2006-01-02"))
+	memo := trail
+	if existing.Memo != nil && *existing.Memo != "" {
+		// Shorten the old memo rather than lose the trail
+		memo = truncate(*existing.Memo, maxMemoLength-len(trail)-3) + " | " + trail
+	}
+
+	update := ynabtransaction.PayloadTransaction{
+		AccountID:  existing.AccountID,
+		Date:       existing.Date,
+		Amount:     payload.Amount,
+		Cleared:    existing.Cleared,
+		Approved:   existing.Approved,
+		PayeeID:    existing.PayeeID,
+		CategoryID: existing.CategoryID,
+		Memo:       markMemo(&memo, marker),
+		FlagColor:  existing.FlagColor,
+		ImportID:   existing.ImportID,
+	}
+
+	log.Printf("Updating transaction %s: %s", existing.ID, trail)
+	return client.call("update transaction", func() error {
+		_, err := client.Transaction().UpdateTransaction(budgetID, existing.ID, update)
+		return err
+	})
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go.bmvs.io/ynab/api"
+	ynabtransaction "go.bmvs.io/ynab/api/transaction"
+)
+
+var _ = Describe("Pending transaction updates", func() {
+
+	var (
+		pending      pendingConfig
+		payload      ynabtransaction.PayloadTransaction
+		transactions []*ynabtransaction.Transaction
+	)
+
+	BeforeEach(func() {
+		pending = defaultPendingConfig()
+		pending.Enabled = true
+		pending.Merchant = "pizza"
+
+		date, _ := api.DateFromString("2020-10-16")
+		payee := "Pizza Place"
+		payload = ynabtransaction.PayloadTransaction{Date: date, Amount: -48500, PayeeName: &payee}
+
+		transactions = []*ynabtransaction.Transaction{
+			ynabTransaction("other", "2020-10-15", -40000, "Gas Station", "Chase *1234 via email"),
+			ynabTransaction("cleared", "2020-10-15", -40000, "Pizza Place", "Chase *1234 via email"),
+			ynabTransaction("original", "2020-10-15", -40000, "Pizza Place", "Chase *1234 via email"),
+			ynabTransaction("toosmall", "2020-10-14", -10000, "Pizza Place", "Chase *1234 via email"),
+		}
+		transactions[1].Cleared = ynabtransaction.ClearingStatusCleared
+	})
+
+	Context("When a second alert arrives, ", func() {
+
+		It("finds the uncleared charge from the same payee", func() {
+			match := matchPending(transactions, payload, pending, "via email", 0.8)
+			Expect(match).NotTo(BeNil())
+			Expect(match.ID).To(Equal("original"))
+		})
+
+		It("ignores charges that changed too much", func() {
+			payload.Amount = -80000
+			Expect(matchPending(transactions, payload, pending, "via email", 0.8)).To(BeNil())
+		})
+
+		It("ignores charges with the same amount", func() {
+			payload.Amount = -40000
+			Expect(matchPending(transactions, payload, pending, "via email", 0.8)).To(BeNil())
+		})
+
+		It("ignores charges we didn't post", func() {
+			transactions[2].Memo = nil
+			Expect(matchPending(transactions, payload, pending, "via email", 0.8)).To(BeNil())
+		})
+	})
+
+	Context("When the config is loaded, ", func() {
+
+		It("requires a merchant", func() {
+			pending.Merchant = ""
+			Expect(pending.compile()).To(HaveOccurred())
+		})
+	})
+
+	Context("When two purchases are made at the same place, ", func() {
+
+		var (
+			config      posterConfig
+			transaction Transaction
+		)
+
+		BeforeEach(func() {
+			config = defaultConfig()
+			config.Pending = pending
+			Expect(config.Pending.compile()).To(Succeed())
+			transaction = Transaction{MessageID: "second", LastDigits: 1234, Date: "2020-10-16", Amount: 48.50, Merchant: "PIZZA PLACE"}
+		})
+
+		It("posts both", func() {
+			Expect(findPendingTransaction(transactions, transaction, payload, config)).To(BeNil())
+		})
+
+		It("updates the authorization when the alert is for its final amount", func() {
+			transaction.Settled = true
+			match := findPendingTransaction(transactions, transaction, payload, config)
+			Expect(match).NotTo(BeNil())
+			Expect(match.ID).To(Equal("original"))
+		})
+	})
+
+})
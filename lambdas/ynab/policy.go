@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	ynabtransaction "go.bmvs.io/ynab/api/transaction"
+)
+
+// policyConfig decides which imported transactions get flagged or approved, so the YNAB
+// review queue only holds transactions that need attention.
+type policyConfig struct {
+	// Evaluated in order, the first match sets the flag
+	Flags []flagRule `json:"flags"`
+	// Names people for flag rules, e.g. {"Alex": [1234, 5678]}
+	Cardholders map[string][]int `json:"cardholders"`
+	// Approve transactions categorized by a category rule marked highConfidence
+	AutoApprove bool `json:"autoApprove"`
+	// Charges in any other currency count as foreign
+	HomeCurrency string `json:"homeCurrency"`
+}
+
+// flagRule sets a flag color on transactions matching its conditions
+type flagRule struct {
+	Name string `json:"name"`
+	ruleConditions
+	// Only match charges in a currency other than the home currency
+	Foreign bool `json:"foreign"`
+	// Only match cards belonging to this cardholder
+	Cardholder string `json:"cardholder"`
+	// red, orange, yellow, green, blue or purple
+	Color string `json:"color"`
+}
+
+var flagColors = map[string]ynabtransaction.FlagColor{
+	"red":    ynabtransaction.FlagColorRed,
+	"orange": ynabtransaction.FlagColorOrange,
+	"yellow": ynabtransaction.FlagColorYellow,
+	"green":  ynabtransaction.FlagColorGreen,
+	"blue":   ynabtransaction.FlagColorBlue,
+	"purple": ynabtransaction.FlagColorPurple,
+}
+
+func defaultPolicyConfig() policyConfig {
+	return policyConfig{
+		Cardholders:  map[string][]int{},
+		HomeCurrency: "USD",
+	}
+}
+
+func compilePolicy(policy policyConfig) error {
+	for i := range policy.Flags {
+		rule := &policy.Flags[i]
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("flag %d", i+1)
+		}
+		if _, ok := flagColors[strings.ToLower(rule.Color)]; !ok {
+			return fmt.Errorf("flag rule %q has an unknown color %q", rule.Name, rule.Color)
+		}
+		if _, ok := policy.Cardholders[rule.Cardholder]; rule.Cardholder != "" && !ok {
+			return fmt.Errorf("flag rule %q has an unknown cardholder %q", rule.Name, rule.Cardholder)
+		}
+		if err := rule.compile(); err != nil {
+			return fmt.Errorf("flag rule %q %v", rule.Name, err)
+		}
+	}
+	return nil
+}
+
+// applyPolicy sets the flag and approval of a payload. categoryRule is the rule that set
+// the category, nil if the category came from anywhere else.
+func applyPolicy(payload *ynabtransaction.PayloadTransaction, transaction Transaction, categoryRule *categoryRule, policy policyConfig) {
+	for _, rule := range policy.Flags {
+		reasons, ok := rule.matches(transaction, policy)
+		if !ok {
+			continue
+		}
+		color := flagColors[strings.ToLower(rule.Color)]
+		payload.FlagColor = &color
+		log.Printf("Flagging %s %s with %s (%s)", transaction.MessageID, rule.Color, rule.Name, strings.Join(reasons, ", "))
+		break
+	}
+
+	if policy.AutoApprove && categoryRule != nil && categoryRule.HighConfidence && payload.CategoryID != nil {
+		log.Printf("Approving %s, categorized by high confidence rule %q", transaction.MessageID, categoryRule.Name)
+		payload.Approved = true
+	}
+}
+
+func (r flagRule) matches(transaction Transaction, policy policyConfig) ([]string, bool) {
+	reasons, ok := r.ruleConditions.matches(transaction)
+	if !ok {
+		return nil, false
+	}
+
+	if r.Foreign {
+		if transaction.Currency == "" || strings.EqualFold(transaction.Currency, policy.HomeCurrency) {
+			return nil, false
+		}
+		reasons = append(reasons, fmt.Sprintf("charged in %s", transaction.Currency))
+	}
+
+	if r.Cardholder != "" {
+		found := false
+		for _, card := range policy.Cardholders[r.Cardholder] {
+			found = found || card == transaction.LastDigits
+		}
+		if !found {
+			return nil, false
+		}
+		reasons = append(reasons, fmt.Sprintf("card belongs to %s", r.Cardholder))
+	}
+	return reasons, true
+}
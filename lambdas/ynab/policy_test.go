@@ -0,0 +1,89 @@
+package main
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	ynabtransaction "go.bmvs.io/ynab/api/transaction"
+)
+
+var _ = Describe("Flag and approval policy", func() {
+
+	var (
+		policy      policyConfig
+		transaction Transaction
+		payload     ynabtransaction.PayloadTransaction
+	)
+
+	BeforeEach(func() {
+		threshold := 500.0
+		policy = defaultPolicyConfig()
+		policy.Cardholders = map[string][]int{"Alex": {5678}}
+		policy.AutoApprove = true
+		policy.Flags = []flagRule{
+			{Name: "large", ruleConditions: ruleConditions{MinAmount: &threshold}, Color: "red"},
+			{Name: "foreign", Foreign: true, Color: "purple"},
+			{Name: "alex", Cardholder: "Alex", Color: "blue"},
+		}
+		Expect(compilePolicy(policy)).To(Succeed())
+
+		transaction = Transaction{
+			MessageID:  "asdfasdfasdfasdf",
+			LastDigits: 1234,
+			Date:       "2020-10-15",
+			Amount:     109.00,
+			Merchant:   "Test Mer\\chant.com",
+			Currency:   "USD",
+		}
+		payload = ynabtransaction.PayloadTransaction{Amount: -109000}
+	})
+
+	Context("When flagging transactions, ", func() {
+
+		It("uses the first matching flag rule", func() {
+			transaction.Amount = 750
+			transaction.Currency = "EUR"
+			applyPolicy(&payload, transaction, nil, policy)
+			Expect(*payload.FlagColor).To(Equal(ynabtransaction.FlagColorRed))
+		})
+
+		It("flags foreign currency charges", func() {
+			transaction.Currency = "EUR"
+			applyPolicy(&payload, transaction, nil, policy)
+			Expect(*payload.FlagColor).To(Equal(ynabtransaction.FlagColorPurple))
+		})
+
+		It("flags a cardholder's cards", func() {
+			transaction.LastDigits = 5678
+			applyPolicy(&payload, transaction, nil, policy)
+			Expect(*payload.FlagColor).To(Equal(ynabtransaction.FlagColorBlue))
+		})
+
+		It("leaves other transactions unflagged", func() {
+			applyPolicy(&payload, transaction, nil, policy)
+			Expect(payload.FlagColor).To(BeNil())
+		})
+
+		It("rejects unknown colors and cardholders", func() {
+			Expect(compilePolicy(policyConfig{Flags: []flagRule{{Color: "pink"}}})).NotTo(Succeed())
+			Expect(compilePolicy(policyConfig{Flags: []flagRule{{Color: "red", Cardholder: "Sam"}}})).NotTo(Succeed())
+		})
+	})
+
+	Context("When approving transactions, ", func() {
+
+		It("approves transactions categorized by a high confidence rule", func() {
+			categoryID := "groceriesid"
+			payload.CategoryID = &categoryID
+			applyPolicy(&payload, transaction, &categoryRule{Name: "costco", HighConfidence: true}, policy)
+			Expect(payload.Approved).To(BeTrue())
+		})
+
+		It("leaves everything else for review", func() {
+			categoryID := "groceriesid"
+			payload.CategoryID = &categoryID
+			applyPolicy(&payload, transaction, &categoryRule{Name: "costco"}, policy)
+			Expect(payload.Approved).To(BeFalse())
+		})
+	})
+
+})
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.bmvs.io/ynab"
+	"go.bmvs.io/ynab/api"
+)
+
+// YNAB allows 200 requests per rolling hour for a personal access token.
+// https://api.youneedabudget.com/#rate-limiting
+const (
+	ynabHost          = "api.youneedabudget.com"
+	ynabBaseURL       = "https://" + ynabHost + "/v1"
+	ynabHourlyLimit   = 200
+	ynabMaxAttempts   = 5
+	ynabBaseBackoff   = 2 * time.Second
+	ynabMaxBackoff    = time.Minute
+	ynabDeadlineSlack = 3 * time.Second
+)
+
+// Usage is kept at package level so warm Lambda containers remember how many
+// requests were already made and whether YNAB asked us to back off.
+var usage = &requestUsage{}
+
+type requestUsage struct {
+	sync.Mutex
+	requests   []time.Time // requests made by this container in the last hour
+	used       int         // as last reported by the X-Rate-Limit header
+	total      int
+	observedAt time.Time
+	retryAt    time.Time // set from Retry-After on a 429
+}
+
+// ynabClient wraps the YNAB client so calls can be counted and retried.
+// Every request made by the poster should go through call.
+type ynabClient struct {
+	ynab.ClientServicer
+	accessToken string
+	deadline    time.Time
+	requests    int
+	usage       *requestUsage
+	sleep       func(time.Duration)
+}
+
+// deferredError is returned when a call failed with a transient error and could
+// not be retried before the Lambda deadline. The record should be kept so it can be
+// posted by a later invocation.
+type deferredError struct {
+	op  string
+	err error
+}
+
+func (e *deferredError) Error() string {
+	return fmt.Sprintf("deferred %s: %s", e.op, e.err.Error())
+}
+
+func (e *deferredError) Unwrap() error {
+	return e.err
+}
+
+func isDeferred(err error) bool {
+	var deferred *deferredError
+	return errors.As(err, &deferred)
+}
+
+func newYnabClient(accessToken string, deadline time.Time) *ynabClient {
+	installRateLimitTransport()
+	return &ynabClient{
+		ClientServicer: ynab.NewClient(accessToken),
+		accessToken:    accessToken,
+		deadline:       deadline,
+		usage:          usage,
+		sleep:          time.Sleep,
+	}
+}
+
+// do sends a request the ynab package has no method for. Like the ynab package it returns
+// an *api.Error for error responses so they are classified the same way. Call it from call.
+func (c *ynabClient) do(method, path string, body interface{}, result interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequest(method, ynabBaseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.accessToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		response := struct {
+			Error *api.Error `json:"error"`
+		}{}
+		if err := json.NewDecoder(resp.Body).Decode(&response); err != nil || response.Error == nil {
+			return &api.Error{ID: strconv.Itoa(resp.StatusCode), Name: http.StatusText(resp.StatusCode)}
+		}
+		return response.Error
+	}
+
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// call runs fn, retrying transient failures with exponential backoff. Permanent
+// errors are returned as is, transient ones that run out of time or attempts are
+// wrapped in a deferredError.
+func (c *ynabClient) call(op string, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		if wait := c.usage.wait(time.Now()); wait > 0 {
+			if !c.canWait(wait) {
+				return &deferredError{op: op, err: fmt.Errorf("rate limit reached, next request allowed in %s", wait.Round(time.Second))}
+			}
+			log.Printf("YNAB rate limit reached, waiting %s before %s", wait.Round(time.Second), op)
+			c.sleep(wait)
+		}
+
+		c.requests++
+		c.usage.record(time.Now())
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		if !isTransient(err) {
+			return err
+		}
+
+		wait := backoff(attempt, c.usage.retryAfter(time.Now()))
+		if attempt >= ynabMaxAttempts || !c.canWait(wait) {
+			return &deferredError{op: op, err: err}
+		}
+		log.Printf("Transient error on %s (attempt %d): %v. Retrying in %s", op, attempt, err, wait)
+		c.sleep(wait)
+	}
+}
+
+func (c *ynabClient) canWait(wait time.Duration) bool {
+	if c.deadline.IsZero() {
+		return true
+	}
+	return time.Now().Add(wait).Before(c.deadline.Add(-ynabDeadlineSlack))
+}
+
+// Summary of request usage for logging at the end of an invocation
+func (c *ynabClient) summary() string {
+	return fmt.Sprintf("%d YNAB requests this invocation, %d remaining this hour", c.requests, c.usage.remaining(time.Now()))
+}
+
+// backoff doubles the wait on every attempt, but never waits less than YNAB asked for.
+func backoff(attempt int, retryAfter time.Duration) time.Duration {
+	wait := ynabBaseBackoff << uint(attempt-1)
+	if wait > ynabMaxBackoff {
+		wait = ynabMaxBackoff
+	}
+	if retryAfter > wait {
+		wait = retryAfter
+	}
+	return wait
+}
+
+// Rate limiting, server errors and network failures are worth retrying.
+// Anything else (bad request, not found, unauthorized) will fail again.
+func isTransient(err error) bool {
+	var apiErr *api.Error
+	if errors.As(err, &apiErr) {
+		status := apiStatus(apiErr)
+		return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// apiStatus is the HTTP status of a YNAB error. YNAB's error IDs are the status, sometimes
+// followed by a detail code like "404.2". When a response has no error body, the ynab
+// package and do above both fill the ID in with the status code, so it is always set.
+func apiStatus(apiErr *api.Error) int {
+	id := apiErr.ID
+	if i := strings.Index(id, "."); i >= 0 {
+		id = id[:i]
+	}
+	status, err := strconv.Atoi(id)
+	if err != nil {
+		return 0
+	}
+	return status
+}
+
+func (u *requestUsage) record(now time.Time) {
+	u.Lock()
+	defer u.Unlock()
+	u.prune(now)
+	u.requests = append(u.requests, now)
+}
+
+// Drop requests that are older than an hour
+func (u *requestUsage) prune(now time.Time) {
+	cutoff := now.Add(-time.Hour)
+	i := 0
+	for i < len(u.requests) && u.requests[i].Before(cutoff) {
+		i++
+	}
+	u.requests = u.requests[i:]
+}
+
+func (u *requestUsage) remaining(now time.Time) int {
+	u.Lock()
+	defer u.Unlock()
+	u.prune(now)
+
+	remaining := ynabHourlyLimit - len(u.requests)
+	if u.total > 0 && now.Sub(u.observedAt) < time.Hour {
+		if reported := u.total - u.used; reported < remaining {
+			remaining = reported
+		}
+	}
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// How long to wait before the next request is allowed
+func (u *requestUsage) wait(now time.Time) time.Duration {
+	if retryAfter := u.retryAfter(now); retryAfter > 0 {
+		return retryAfter
+	}
+	if u.remaining(now) > 0 {
+		return 0
+	}
+
+	u.Lock()
+	defer u.Unlock()
+	if len(u.requests) == 0 {
+		// Only the header says we are out of requests. It does not say when they free up.
+		return ynabMaxBackoff
+	}
+	return u.requests[0].Add(time.Hour).Sub(now)
+}
+
+func (u *requestUsage) retryAfter(now time.Time) time.Duration {
+	u.Lock()
+	defer u.Unlock()
+	if u.retryAt.After(now) {
+		return u.retryAt.Sub(now)
+	}
+	return 0
+}
+
+// observe reads the X-Rate-Limit ("36/200") and Retry-After headers from a YNAB response
+func (u *requestUsage) observe(header http.Header, status int, now time.Time) {
+	u.Lock()
+	defer u.Unlock()
+
+	if limit := header.Get("X-Rate-Limit"); limit != "" {
+		parts := strings.SplitN(limit, "/", 2)
+		if len(parts) == 2 {
+			used, uerr := strconv.Atoi(strings.TrimSpace(parts[0]))
+			total, terr := strconv.Atoi(strings.TrimSpace(parts[1]))
+			if uerr == nil && terr == nil {
+				u.used = used
+				u.total = total
+				u.observedAt = now
+			}
+		}
+	}
+
+	if status == http.StatusTooManyRequests {
+		u.retryAt = now.Add(parseRetryAfter(header.Get("Retry-After"), now))
+	}
+}
+
+// Retry-After is either a number of seconds or an HTTP date
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
+
+// rateLimitTransport watches responses from the YNAB API. The ynab package does
+// not expose response headers, so this is the only place we can see them.
+type rateLimitTransport struct {
+	next http.RoundTripper
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err == nil && req.URL.Host == ynabHost {
+		usage.observe(resp.Header, resp.StatusCode, time.Now())
+	}
+	return resp, err
+}
+
+// The ynab package sends its requests with http.DefaultClient
+func installRateLimitTransport() {
+	if _, ok := http.DefaultClient.Transport.(*rateLimitTransport); ok {
+		return
+	}
+	next := http.DefaultClient.Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	http.DefaultClient.Transport = &rateLimitTransport{next: next}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go.bmvs.io/ynab/api"
+)
+
+var _ = Describe("Rate limited YNAB client", func() {
+
+	var (
+		client *ynabClient
+		slept  []time.Duration
+	)
+
+	BeforeEach(func() {
+		slept = nil
+		client = &ynabClient{
+			deadline: time.Now().Add(time.Hour),
+			usage:    &requestUsage{},
+			sleep: func(d time.Duration) {
+				slept = append(slept, d)
+			},
+		}
+	})
+
+	Context("When classifying errors, ", func() {
+
+		It("retries rate limits and server errors", func() {
+			Expect(isTransient(&api.Error{ID: "429", Name: "too_many_requests"})).To(BeTrue())
+			Expect(isTransient(&api.Error{ID: "503", Name: "service_unavailable"})).To(BeTrue())
+		})
+
+		It("does not retry bad requests", func() {
+			Expect(isTransient(&api.Error{ID: "400", Name: "bad_request"})).To(BeFalse())
+			Expect(isTransient(&api.Error{ID: "404.2", Name: "resource_not_found"})).To(BeFalse())
+			Expect(isTransient(fmt.Errorf("could not find account"))).To(BeFalse())
+			Expect(isTransient(fmt.Errorf("no payee with id=50"))).To(BeFalse())
+		})
+
+		It("retries wrapped API errors", func() {
+			Expect(isTransient(fmt.Errorf("creating transaction: %w", &api.Error{ID: "500"}))).To(BeTrue())
+		})
+	})
+
+	Context("When calling YNAB, ", func() {
+
+		It("retries transient errors with backoff", func() {
+			calls := 0
+			err := client.call("test", func() error {
+				calls++
+				if calls < 3 {
+					return &api.Error{ID: "429"}
+				}
+				return nil
+			})
+			Expect(err).To(BeNil())
+			Expect(calls).To(Equal(3))
+			Expect(slept).To(Equal([]time.Duration{2 * time.Second, 4 * time.Second}))
+			Expect(client.requests).To(Equal(3))
+		})
+
+		It("returns permanent errors immediately", func() {
+			calls := 0
+			err := client.call("test", func() error {
+				calls++
+				return &api.Error{ID: "404.2", Name: "resource_not_found"}
+			})
+			Expect(err).NotTo(BeNil())
+			Expect(isDeferred(err)).To(BeFalse())
+			Expect(calls).To(Equal(1))
+		})
+
+		It("defers when the deadline would pass", func() {
+			client.deadline = time.Now().Add(5 * time.Second)
+			err := client.call("test", func() error {
+				return &api.Error{ID: "429"}
+			})
+			Expect(isDeferred(err)).To(BeTrue())
+			Expect(slept).To(BeEmpty())
+		})
+	})
+
+	Context("When reading rate limit headers, ", func() {
+
+		It("honours Retry-After on a 429", func() {
+			now := time.Now()
+			header := http.Header{}
+			header.Set("X-Rate-Limit", "199/200")
+			header.Set("Retry-After", "30")
+			client.usage.observe(header, http.StatusTooManyRequests, now)
+			Expect(client.usage.remaining(now)).To(Equal(1))
+			Expect(client.usage.retryAfter(now)).To(Equal(30 * time.Second))
+			Expect(backoff(1, client.usage.retryAfter(now))).To(Equal(30 * time.Second))
+		})
+	})
+
+})
@@ -0,0 +1,449 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"go.bmvs.io/ynab/api"
+	ynabtransaction "go.bmvs.io/ynab/api/transaction"
+)
+
+// receiptConfig controls merging receipts (Amazon orders, Uber and Lyft rides, DoorDash, Apple)
+// with the card alert for the same charge. The email lambda stores receipts in the transactions
+// table. Whichever of the two arrives second merges the receipt into a single YNAB transaction.
+type receiptConfig struct {
+	Enabled bool `json:"enabled"`
+	// Regular expression for the card descriptor of each receipt parser's charges
+	Merchants map[string]string `json:"merchants"`
+	// How many days after the receipt the charge may arrive
+	WindowDays int `json:"windowDays"`
+	// Split the charge by item, categorizing each item with the category rules
+	SplitItems bool `json:"splitItems"`
+
+	merchants map[string]*regexp.Regexp
+	// The parser name as a word, e.g. "Apple" but not "Applebee's"
+	names map[string]*regexp.Regexp
+}
+
+// receiptRecord is a receipt as stored by the email lambda
+type receiptRecord struct {
+	MessageID string `json:"messageID"`
+	Date      string
+	Amount    float32
+	Merchant  string
+	Parser    string
+	Items     []receiptItem
+	Tip       float32
+	// Trip destination, restaurant and the like
+	Details string
+}
+
+type receiptItem struct {
+	Title string
+	Price float32
+}
+
+// itemGroup is the items of a receipt that go in the same category
+type itemGroup struct {
+	rule   *categoryRule // nil for items no rule matched
+	price  float64
+	titles []string
+}
+
+func defaultReceiptConfig() receiptConfig {
+	return receiptConfig{
+		Merchants: map[string]string{
+			"Amazon":   "amzn|amazon",
+			"Uber":     "uber",
+			"Lyft":     "lyft",
+			"DoorDash": "doordash",
+			"Apple":    "apple\\.com|itunes",
+		},
+		WindowDays: 14,
+	}
+}
+
+func (r *receiptConfig) compile() error {
+	r.merchants = map[string]*regexp.Regexp{}
+	r.names = map[string]*regexp.Regexp{}
+	for parser, pattern := range r.Merchants {
+		re, err := regexp.Compile("(?i)" + pattern)
+		if err != nil {
+			return fmt.Errorf("has an invalid merchant pattern for %s: %v", parser, err)
+		}
+		r.merchants[strings.ToLower(parser)] = re
+		r.names[strings.ToLower(parser)] = regexp.MustCompile(`(?i)\b` + regexp.QuoteMeta(parser) + `\b`)
+	}
+	return nil
+}
+
+// chargeMatches is true when a charge from merchant for amount on date could be the receipt's
+func (r receiptConfig) chargeMatches(receipt *receiptRecord, merchant string, amount int64, date time.Time) bool {
+	re, ok := r.merchants[strings.ToLower(receipt.Parser)]
+	return ok && re.MatchString(merchant) && r.totalMatches(receipt, amount, date)
+}
+
+// postedMatches is chargeMatches for a transaction already in YNAB. Its payee may have been
+// cleaned up or renamed by an alias, e.g. "APPLE.COM/BILL" to "Apple", so the receipt
+// parser's name is accepted as well as the descriptor.
+func (r receiptConfig) postedMatches(receipt *receiptRecord, payee string, amount int64, date time.Time) bool {
+	name, ok := r.names[strings.ToLower(receipt.Parser)]
+	if !ok {
+		return false
+	}
+	if r.chargeMatches(receipt, payee, amount, date) {
+		return true
+	}
+	return name.MatchString(payee) && r.totalMatches(receipt, amount, date)
+}
+
+func (r receiptConfig) totalMatches(receipt *receiptRecord, amount int64, date time.Time) bool {
+	if amount != cents(receipt.Amount) {
+		return false
+	}
+	days, ok := receipt.daysUntil(date)
+	return ok && days >= -1 && days <= float64(r.WindowDays)
+}
+
+// Alert dates are in the bank's time zone, so a charge may seem to be a day before the receipt
+func (r *receiptRecord) daysUntil(date time.Time) (float64, bool) {
+	issued, err := time.Parse("2006-01-02", r.Date)
+	if err != nil {
+		return 0, false
+	}
+	return date.Sub(issued).Hours() / 24, true
+}
+
+func cents(amount float32) int64 {
+	return int64(math.Round(float64(amount) * 100))
+}
+
+// findReceipt looks for a stored receipt for a card charge
+func findReceipt(client *dynamodb.DynamoDB, transaction Transaction, config receiptConfig) (*receiptRecord, error) {
+	if !config.Enabled || transaction.Type != transactionPurchase {
+		return nil, nil
+	}
+	receipts, err := getReceipts(client)
+	if err != nil {
+		return nil, err
+	}
+	return matchReceipt(receipts, transaction, config), nil
+}
+
+// getReceipts scans the table for receipts. There are only ever a handful.
+func getReceipts(client *dynamodb.DynamoDB) ([]receiptRecord, error) {
+	creds, _ := getCredentials()
+	input := &dynamodb.ScanInput{
+		TableName:                aws.String(creds.tableName),
+		FilterExpression:         aws.String("#type = :receipt"),
+		ExpressionAttributeNames: map[string]*string{"#type": aws.String("Type")},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":receipt": {S: aws.String(transactionReceipt)},
+		},
+	}
+
+	var receipts []receiptRecord
+	var unmarshalErr error
+	err := client.ScanPages(input, func(page *dynamodb.ScanOutput, last bool) bool {
+		var records []receiptRecord
+		unmarshalErr = dynamodbattribute.UnmarshalListOfMaps(page.Items, &records)
+		receipts = append(receipts, records...)
+		return unmarshalErr == nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return receipts, unmarshalErr
+}
+
+// getReceipt reads one receipt. Stream records don't carry the items in a usable form.
+func getReceipt(client *dynamodb.DynamoDB, messageID string) (*receiptRecord, error) {
+	creds, _ := getCredentials()
+	key, err := getDynamoKey(messageID)
+	if err != nil {
+		return nil, err
+	}
+	result, err := client.GetItem(&dynamodb.GetItemInput{
+		Key:            key,
+		TableName:      aws.String(creds.tableName),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Item) == 0 {
+		return nil, fmt.Errorf("receipt %s not found", messageID)
+	}
+	var receipt receiptRecord
+	err = dynamodbattribute.UnmarshalMap(result.Item, &receipt)
+	return &receipt, err
+}
+
+// matchReceipt picks the receipt with the same total issued closest before the charge
+func matchReceipt(receipts []receiptRecord, transaction Transaction, config receiptConfig) *receiptRecord {
+	charged, err := time.Parse("2006-01-02", transaction.Date)
+	if err != nil {
+		return nil
+	}
+
+	var best *receiptRecord
+	var bestDays float64
+	for i := range receipts {
+		receipt := &receipts[i]
+		if !config.chargeMatches(receipt, transaction.Merchant, cents(transaction.Amount), charged) {
+			continue
+		}
+		days, _ := receipt.daysUntil(charged)
+		if best == nil || math.Abs(days) < math.Abs(bestDays) {
+			best, bestDays = receipt, days
+		}
+	}
+	return best
+}
+
+// receiptMemo describes what the receipt adds, followed by the memo the transaction already had
+func receiptMemo(receipt *receiptRecord, memo *string) *string {
+	var parts []string
+	if receipt.Details != "" {
+		parts = append(parts, receipt.Details)
+	}
+	for _, item := range receipt.Items {
+		parts = append(parts, item.Title)
+	}
+	if receipt.Tip > 0 {
+		parts = append(parts, fmt.Sprintf("tip %.2f", receipt.Tip))
+	}
+	text := strings.Join(parts, "; ")
+	if memo != nil && *memo != "" {
+		text += " | " + *memo
+	}
+	text = truncate(text, maxMemoLength)
+	return &text
+}
+
+// groupReceiptItems puts the items in groups by the category rule matching their title
+func groupReceiptItems(receipt *receiptRecord, transaction Transaction, rules []categoryRule) []itemGroup {
+	var groups []itemGroup
+	index := map[*categoryRule]int{}
+	for _, item := range receipt.Items {
+		// Rules see the item title as the merchant, e.g. a rule for parser "Amazon" and merchant "book"
+		itemTransaction := transaction
+		itemTransaction.Merchant = item.Title
+		itemTransaction.Amount = item.Price
+		itemTransaction.Parser = receipt.Parser
+
+		var rule *categoryRule
+		if match, ok := matchRule(rules, itemTransaction); ok {
+			rule = match.rule
+		}
+		i, ok := index[rule]
+		if !ok {
+			i = len(groups)
+			index[rule] = i
+			groups = append(groups, itemGroup{rule: rule})
+		}
+		groups[i].price += float64(item.Price)
+		groups[i].titles = append(groups[i].titles, item.Title)
+	}
+	return groups
+}
+
+// splitReceipt splits the charge by the categories of its items. Tax, fees and tips are spread
+// over the items by price. Items no rule matched keep the transaction's category.
+func splitReceipt(client *ynabClient, budgetID string, transaction Transaction, payload ynabtransaction.PayloadTransaction, receipt *receiptRecord, rules []categoryRule) ([]subTransaction, error) {
+	groups := groupReceiptItems(receipt, transaction, rules)
+	if len(groups) < 2 {
+		return nil, nil
+	}
+	log.Printf("Splitting %s by the items of receipt %s", transaction.MessageID, receipt.MessageID)
+
+	categories, err := getCategories(client, budgetID)
+	if err != nil {
+		return nil, err
+	}
+
+	total := 0.0
+	for _, group := range groups {
+		total += group.price
+	}
+	parts := make([]splitPart, len(groups))
+	for i, group := range groups {
+		percent := group.price / total * 100
+		parts[i] = splitPart{Percent: &percent}
+	}
+	parts[len(parts)-1] = splitPart{Remainder: true}
+	amounts := splitAmounts(payload.Amount, parts)
+
+	subtransactions := make([]subTransaction, 0, len(groups))
+	for i, group := range groups {
+		categoryID := payload.CategoryID
+		if group.rule != nil {
+			id, err := findCategoryID(categories, group.rule.Category)
+			if err != nil {
+				return nil, fmt.Errorf("category rule %q: %v", group.rule.Name, err)
+			}
+			categoryID = &id
+		}
+		memo := truncate(strings.Join(group.titles, "; "), maxMemoLength)
+		subtransactions = append(subtransactions, subTransaction{Amount: amounts[i], CategoryID: categoryID, Memo: &memo})
+	}
+	return subtransactions, nil
+}
+
+// handleReceipt merges a receipt into the transaction its card alert already posted. Without
+// one the receipt is kept until the alert arrives, or DynamoDB expires it.
+func handleReceipt(client *ynabClient, dynamo *dynamodb.DynamoDB, accounts []budgetAccount, messageID string, config posterConfig) error {
+	if !config.Receipts.Enabled {
+		return nil
+	}
+	receipt, err := getReceipt(dynamo, messageID)
+	if err != nil {
+		notifyError("Could not read receipt", err)
+		return err
+	}
+
+	budgetID, existing, err := findPostedTransaction(client, accounts, receipt, config.Receipts)
+	if isDeferred(err) {
+		notifyError("YNAB unavailable or rate limited. Deferring receipt", err)
+		return err
+	}
+	if err != nil {
+		// Keep it, the alert may still match it
+		log.Printf("Could not look for the transaction of receipt %s: %v", messageID, err)
+		return nil
+	}
+	if existing == nil {
+		log.Printf("Keeping receipt %s until its charge arrives", messageID)
+		return nil
+	}
+
+	log.Printf("Receipt %s is for transaction %s", messageID, existing.ID)
+	update := ynabtransaction.PayloadTransaction{
+		AccountID:  existing.AccountID,
+		Date:       existing.Date,
+		Amount:     existing.Amount,
+		Cleared:    existing.Cleared,
+		Approved:   existing.Approved,
+		PayeeID:    existing.PayeeID,
+		CategoryID: existing.CategoryID,
+		Memo:       receiptMemo(receipt, existing.Memo),
+		FlagColor:  existing.FlagColor,
+		ImportID:   existing.ImportID,
+	}
+
+	// The receipt text goes first and may push the marker out
+	if hasMarker(existing.Memo, config.MemoMarker) {
+		update.Memo = markMemo(update.Memo, config.MemoMarker)
+	}
+
+	var subtransactions []subTransaction
+	if config.Receipts.SplitItems {
+		// Rules with card conditions don't match here, the alert's digits aren't kept in YNAB
+		charge := Transaction{
+			MessageID: existing.ID,
+			Date:      existing.Date.Format("2006-01-02"),
+			Amount:    float32(-existing.Amount) / 1000,
+			Merchant:  *existing.PayeeName,
+		}
+		subtransactions, err = splitReceipt(client, budgetID, charge, update, receipt, config.CategoryRules)
+		if isDeferred(err) {
+			notifyError("YNAB unavailable or rate limited. Deferring receipt", err)
+			return err
+		}
+		if err != nil {
+			// Still add the receipt to the memo
+			notifyError("Could not split receipt", err)
+			subtransactions = nil
+		}
+	}
+
+	err = client.call("update transaction", func() error {
+		if len(subtransactions) > 0 {
+			// YNAB assigns the split category itself
+			update.CategoryID = nil
+			return updateSplitTransaction(client, budgetID, existing.ID, update, subtransactions)
+		}
+		_, err := client.Transaction().UpdateTransaction(budgetID, existing.ID, update)
+		return err
+	})
+	if isDeferred(err) {
+		notifyError("YNAB unavailable or rate limited. Deferring receipt", err)
+		return err
+	}
+	if err != nil {
+		notifyError("Could not add receipt to transaction", err)
+		return nil
+	}
+
+	err = deleteDynamoRecord(dynamo, messageID)
+	if err != nil {
+		notifyError("Could not delete receipt record", err)
+		return err
+	}
+	s3Client, err := createS3Client(region)
+	if err != nil {
+		notifyError("Could not create s3 client", err)
+		return err
+	}
+	err = deleteS3Object(s3Client, messageID)
+	if err != nil {
+		notifyError("Could not delete s3 bucket object", err)
+		return err
+	}
+	return nil
+}
+
+// findPostedTransaction looks through every budget for a posted charge the receipt is for
+func findPostedTransaction(client *ynabClient, accounts []budgetAccount, receipt *receiptRecord, config receiptConfig) (string, *ynabtransaction.Transaction, error) {
+	issued, err := time.Parse("2006-01-02", receipt.Date)
+	if err != nil {
+		return "", nil, err
+	}
+	since := api.Date{Time: issued.AddDate(0, 0, -1)}
+
+	seen := map[string]bool{}
+	for _, account := range accounts {
+		if seen[account.budgetID] {
+			continue
+		}
+		seen[account.budgetID] = true
+
+		var transactions []*ynabtransaction.Transaction
+		err := client.call("get transactions for receipt", func() (err error) {
+			transactions, err = client.Transaction().GetTransactions(account.budgetID, &ynabtransaction.Filter{Since: &since})
+			return
+		})
+		if err != nil {
+			return "", nil, err
+		}
+		if existing := matchPostedTransaction(transactions, receipt, config); existing != nil {
+			return account.budgetID, existing, nil
+		}
+	}
+	return "", nil, nil
+}
+
+// matchPostedTransaction finds an outflow with the receipt's total to a payee the receipt's
+// merchant pattern or parser name matches, that no receipt was merged into yet
+func matchPostedTransaction(transactions []*ynabtransaction.Transaction, receipt *receiptRecord, config receiptConfig) *ynabtransaction.Transaction {
+	for _, existing := range transactions {
+		if existing.Deleted || existing.TransferAccountID != nil || len(existing.SubTransactions) > 0 || existing.PayeeName == nil {
+			continue
+		}
+		if existing.Amount%10 != 0 || !config.postedMatches(receipt, *existing.PayeeName, -existing.Amount/10, existing.Date.Time) {
+			continue
+		}
+		if existing.Memo != nil && strings.HasPrefix(*existing.Memo, *receiptMemo(receipt, nil)) {
+			continue
+		}
+		return existing
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	ynabtransaction "go.bmvs.io/ynab/api/transaction"
+)
+
+var _ = Describe("Receipt correlation", func() {
+
+	var (
+		config      receiptConfig
+		transaction Transaction
+		receipts    []receiptRecord
+	)
+
+	BeforeEach(func() {
+		config = defaultReceiptConfig()
+		config.Enabled = true
+		Expect(config.compile()).To(Succeed())
+
+		transaction = Transaction{MessageID: "charge", LastDigits: 1234, Date: "2020-10-20", Amount: 52.00, Merchant: "AMZN Mktp US*2K4LO1AB2"}
+		receipts = []receiptRecord{
+			{MessageID: "other", Date: "2020-10-19", Amount: 19.99, Parser: "Amazon"},
+			{MessageID: "old", Date: "2020-09-01", Amount: 52.00, Parser: "Amazon"},
+			{MessageID: "uber", Date: "2020-10-20", Amount: 52.00, Parser: "Uber", Tip: 4, Details: "500 Pine St"},
+			{MessageID: "earlier", Date: "2020-10-12", Amount: 52.00, Parser: "Amazon"},
+			{MessageID: "order", Date: "2020-10-18", Amount: 52.00, Parser: "Amazon", Items: []receiptItem{
+				{Title: "USB-C Cable, 6ft", Price: 12.99},
+				{Title: "The Go Programming Language (Paperback)", Price: 34.50},
+			}},
+		}
+	})
+
+	Context("When a card alert arrives after the receipt, ", func() {
+
+		It("matches the closest receipt from the same merchant with the same total", func() {
+			receipt := matchReceipt(receipts, transaction, config)
+			Expect(receipt).NotTo(BeNil())
+			Expect(receipt.MessageID).To(Equal("order"))
+
+			transaction.Merchant = "UBER   *TRIP"
+			receipt = matchReceipt(receipts, transaction, config)
+			Expect(receipt).NotTo(BeNil())
+			Expect(receipt.MessageID).To(Equal("uber"))
+		})
+
+		It("ignores receipts outside the window", func() {
+			transaction.Date = "2020-11-20"
+			Expect(matchReceipt(receipts, transaction, config)).To(BeNil())
+		})
+
+		It("describes the receipt in the memo", func() {
+			memo := "Chase *1234"
+			Expect(*receiptMemo(&receipts[4], &memo)).To(Equal("USB-C Cable, 6ft; The Go Programming Language (Paperback) | Chase *1234"))
+			Expect(*receiptMemo(&receipts[2], nil)).To(Equal("500 Pine St; tip 4.00"))
+		})
+
+		It("groups items by the category rule matching their title", func() {
+			rules := []categoryRule{
+				{Name: "books", ruleConditions: ruleConditions{Merchant: "paperback|hardcover", Parsers: []string{"Amazon"}}, Category: "Books"},
+			}
+			Expect(compileRules(rules)).To(Succeed())
+
+			groups := groupReceiptItems(&receipts[4], transaction, rules)
+			Expect(groups).To(HaveLen(2))
+			Expect(groups[0].rule).To(BeNil())
+			Expect(groups[0].titles).To(Equal([]string{"USB-C Cable, 6ft"}))
+			Expect(groups[1].rule.Name).To(Equal("books"))
+		})
+	})
+
+	Context("When the receipt arrives after the card alert, ", func() {
+
+		It("finds the posted charge", func() {
+			transactions := []*ynabtransaction.Transaction{
+				ynabTransaction("grocer", "2020-10-20", -52000, "Grocer", ""),
+				ynabTransaction("merged", "2020-10-20", -52000, "Uber", "500 Pine St; tip 4.00"),
+				ynabTransaction("ride", "2020-10-20", -52000, "Uber", ""),
+			}
+			existing := matchPostedTransaction(transactions, &receipts[2], config)
+			Expect(existing).NotTo(BeNil())
+			Expect(existing.ID).To(Equal("ride"))
+		})
+
+		It("finds charges whose payee was renamed", func() {
+			apple := receiptRecord{MessageID: "apple", Date: "2020-10-19", Amount: 12.98, Parser: "Apple"}
+			transactions := []*ynabtransaction.Transaction{
+				ynabTransaction("bees", "2020-10-20", -12980, "Applebee's", ""),
+				ynabTransaction("icloud", "2020-10-20", -12980, "Apple", ""),
+			}
+			existing := matchPostedTransaction(transactions, &apple, config)
+			Expect(existing).NotTo(BeNil())
+			Expect(existing.ID).To(Equal("icloud"))
+		})
+
+		It("finds nothing when the charge hasn't been posted", func() {
+			transactions := []*ynabtransaction.Transaction{
+				ynabTransaction("ride", "2020-10-20", -23450, "Uber", ""),
+			}
+			Expect(matchPostedTransaction(transactions, &receipts[2], config)).To(BeNil())
+		})
+	})
+
+})
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"go.bmvs.io/ynab/api"
+	ynabbudget "go.bmvs.io/ynab/api/budget"
+	ynabtransaction "go.bmvs.io/ynab/api/transaction"
+)
+
+// reconcileConfig tells the reconciliation report which transactions came from which source
+type reconcileConfig struct {
+	// Import ID prefix of bank-imported transactions. YNAB uses "YNAB:" for direct import.
+	BankImportPrefix string `json:"bankImportPrefix"`
+	// How many days apart an email and a bank transaction for the same charge may be
+	MatchDays int `json:"matchDays"`
+}
+
+func defaultReconcileConfig() reconcileConfig {
+	return reconcileConfig{
+		BankImportPrefix: "YNAB:",
+		MatchDays:        3,
+	}
+}
+
+// reconcileReport is what one account looks like after the bank import caught up
+type reconcileReport struct {
+	Account string
+	// Email transactions YNAB matched with a bank import
+	Matched int
+	// Email and bank transactions for what looks like the same charge that YNAB left separate
+	Orphaned [][2]*ynabtransaction.Transaction
+	// Email transactions the bank hasn't imported
+	EmailOnly []*ynabtransaction.Transaction
+	// Bank transactions no alert was sent for, e.g. below the bank's alert threshold
+	BankOnly []*ynabtransaction.Transaction
+}
+
+func (c reconcileConfig) bankImported(transaction *ynabtransaction.Transaction) bool {
+	return transaction.ImportID != nil && strings.HasPrefix(*transaction.ImportID, c.BankImportPrefix)
+}
+
+// reconcileTransactions sorts an account's transactions between since and until into the report.
+// Email imports are recognized by the marker the poster adds to every memo. It never sets an
+// import ID, YNAB would treat the transaction as imported and not match it with the bank's import.
+// When YNAB matches an email transaction with the bank import the result keeps our memo and
+// gets the bank's import ID, so it counts as both.
+func reconcileTransactions(transactions []*ynabtransaction.Transaction, since, until time.Time, marker string, config reconcileConfig) reconcileReport {
+	var report reconcileReport
+	var emailOnly, bankOnly []*ynabtransaction.Transaction
+	for _, transaction := range transactions {
+		if transaction.Deleted || transaction.Date.Before(since) || transaction.Date.After(until) {
+			continue
+		}
+		email, bank := hasMarker(transaction.Memo, marker), config.bankImported(transaction)
+		switch {
+		case email && bank:
+			report.Matched++
+		case email:
+			emailOnly = append(emailOnly, transaction)
+		case bank:
+			bankOnly = append(bankOnly, transaction)
+		}
+	}
+
+	// Pair what is left by amount, closest dates first
+	paired := map[*ynabtransaction.Transaction]bool{}
+	for _, email := range emailOnly {
+		var best *ynabtransaction.Transaction
+		bestDays := math.MaxFloat64
+		for _, bank := range bankOnly {
+			if paired[bank] || bank.Amount != email.Amount {
+				continue
+			}
+			days := math.Abs(bank.Date.Sub(email.Date.Time).Hours() / 24)
+			if days <= float64(config.MatchDays) && days < bestDays {
+				best, bestDays = bank, days
+			}
+		}
+		if best != nil {
+			paired[email], paired[best] = true, true
+			report.Orphaned = append(report.Orphaned, [2]*ynabtransaction.Transaction{email, best})
+		}
+	}
+	for _, email := range emailOnly {
+		if !paired[email] {
+			report.EmailOnly = append(report.EmailOnly, email)
+		}
+	}
+	for _, bank := range bankOnly {
+		if !paired[bank] {
+			report.BankOnly = append(report.BankOnly, bank)
+		}
+	}
+	return report
+}
+
+func (r reconcileReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %d matched, %d orphaned, %d email only, %d bank only\n", r.Account, r.Matched, len(r.Orphaned), len(r.EmailOnly), len(r.BankOnly))
+	for _, pair := range r.Orphaned {
+		fmt.Fprintf(&b, "  Orphaned: %s and %s\n", describeTransaction(pair[0]), describeTransaction(pair[1]))
+	}
+	for _, transaction := range r.EmailOnly {
+		fmt.Fprintf(&b, "  Email only: %s\n", describeTransaction(transaction))
+	}
+	for _, transaction := range r.BankOnly {
+		fmt.Fprintf(&b, "  Bank only: %s\n", describeTransaction(transaction))
+	}
+	return b.String()
+}
+
+// printReconciliation reports unmatched email and bank transactions for every card account,
+// e.g. "ynab reconcile -since 2020-10-01 -until 2020-10-31 -account Sapphire -slack"
+func printReconciliation(args []string) error {
+	flags := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+	sinceFlag := flags.String("since", time.Now().AddDate(0, 0, -30).Format("2006-01-02"), "first date to reconcile")
+	untilFlag := flags.String("until", time.Now().Format("2006-01-02"), "last date to reconcile")
+	accountFlag := flags.String("account", "", "only reconcile accounts with this name")
+	slack := flags.Bool("slack", false, "send the report to Slack as well")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	since, err := api.DateFromString(*sinceFlag)
+	if err != nil {
+		return fmt.Errorf("invalid since date: %v", err)
+	}
+	until, err := api.DateFromString(*untilFlag)
+	if err != nil {
+		return fmt.Errorf("invalid until date: %v", err)
+	}
+
+	credentials, err := getCredentials()
+	if err != nil {
+		return err
+	}
+	config, err := loadConfig(credentials.configFile)
+	if err != nil {
+		return err
+	}
+	if config.MemoMarker == "" {
+		return fmt.Errorf("reconcile needs a memoMarker to recognize email-imported transactions")
+	}
+
+	client := newYnabClient(credentials.accessToken, time.Time{})
+	var budgets []*ynabbudget.Summary
+	err = client.call("get budgets", func() (err error) {
+		budgets, err = client.Budget().GetBudgets()
+		return
+	})
+	if err != nil {
+		return err
+	}
+	accounts, err := getAccounts(client, budgets)
+	if err != nil {
+		return err
+	}
+
+	var reports []string
+	for _, account := range accounts {
+		// Only the card accounts alerts are posted to
+		if account.account.Closed || len(noteDigits(account.account.Note)) == 0 {
+			continue
+		}
+		if *accountFlag != "" && !strings.EqualFold(account.account.Name, *accountFlag) {
+			continue
+		}
+
+		var transactions []*ynabtransaction.Transaction
+		err := client.call("get account transactions", func() (err error) {
+			transactions, err = client.Transaction().GetTransactionsByAccount(account.budgetID, account.account.ID, &ynabtransaction.Filter{Since: &since})
+			return
+		})
+		if err != nil {
+			return err
+		}
+
+		report := reconcileTransactions(transactions, since.Time, until.Time, config.MemoMarker, config.Reconcile)
+		report.Account = account.account.Name
+		reports = append(reports, report.String())
+	}
+	sort.Strings(reports)
+
+	output := strings.Join(reports, "")
+	fmt.Print(output)
+	if *slack && output != "" {
+		notify(fmt.Sprintf("YNAB Importer - Reconciliation %s to %s\n%s", *sinceFlag, *untilFlag, output))
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	ynabtransaction "go.bmvs.io/ynab/api/transaction"
+)
+
+var _ = Describe("Reconciliation", func() {
+
+	var (
+		config       reconcileConfig
+		marker       string
+		since, until time.Time
+	)
+
+	BeforeEach(func() {
+		config = defaultReconcileConfig()
+		// What the poster adds to every memo
+		marker = defaultConfig().MemoMarker
+		since = time.Date(2020, 10, 1, 0, 0, 0, 0, time.UTC)
+		until = time.Date(2020, 10, 31, 0, 0, 0, 0, time.UTC)
+	})
+
+	Context("When the bank import has caught up, ", func() {
+
+		It("sorts transactions by source", func() {
+			report := reconcileTransactions([]*ynabtransaction.Transaction{
+				imported(ynabTransaction("matched", "2020-10-02", -1000, "", "Coffee via email"), "YNAB:-1000:2020-10-02:1"),
+				ynabTransaction("email", "2020-10-05", -2500, "", "via email"),
+				ynabTransaction("orphan email", "2020-10-10", -4000, "", "via email"),
+				imported(ynabTransaction("orphan bank", "2020-10-11", -4000, "", ""), "YNAB:-4000:2020-10-11:1"),
+				imported(ynabTransaction("bank", "2020-10-12", -300, "", ""), "YNAB:-300:2020-10-12:1"),
+				ynabTransaction("manual", "2020-10-12", -700, "", ""),
+				ynabTransaction("outside", "2020-09-12", -700, "", "via email"),
+			}, since, until, marker, config)
+
+			Expect(report.Matched).To(Equal(1))
+			Expect(report.Orphaned).To(HaveLen(1))
+			Expect(report.Orphaned[0][0].ID).To(Equal("orphan email"))
+			Expect(report.Orphaned[0][1].ID).To(Equal("orphan bank"))
+			Expect(report.EmailOnly).To(HaveLen(1))
+			Expect(report.EmailOnly[0].ID).To(Equal("email"))
+			Expect(report.BankOnly).To(HaveLen(1))
+			Expect(report.BankOnly[0].ID).To(Equal("bank"))
+		})
+
+		It("doesn't pair transactions too far apart", func() {
+			report := reconcileTransactions([]*ynabtransaction.Transaction{
+				ynabTransaction("email", "2020-10-01", -4000, "", "via email"),
+				imported(ynabTransaction("bank", "2020-10-20", -4000, "", ""), "YNAB:-4000:2020-10-20:1"),
+			}, since, until, marker, config)
+
+			Expect(report.Orphaned).To(BeEmpty())
+			Expect(report.EmailOnly).To(HaveLen(1))
+			Expect(report.BankOnly).To(HaveLen(1))
+		})
+	})
+
+})
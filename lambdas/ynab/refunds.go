@@ -0,0 +1,110 @@
+package main
+
+import (
+	"log"
+
+	"go.bmvs.io/ynab/api"
+	ynabtransaction "go.bmvs.io/ynab/api/transaction"
+)
+
+// refundConfig controls how far back a refund looks for the purchase it reverses
+type refundConfig struct {
+	WindowDays int `json:"windowDays"`
+}
+
+func defaultRefundConfig() refundConfig {
+	return refundConfig{WindowDays: 90}
+}
+
+// prepareRefund builds an inflow in the category of the purchase being refunded, so the
+// refund reverses the spending where it was budgeted. Without a purchase the category rules apply.
+func prepareRefund(client *ynabClient, config posterConfig, transaction Transaction, account budgetAccount) (ynabtransaction.PayloadTransaction, error) {
+	payload, err := getPayload(transaction, account)
+	if err != nil {
+		return payload, err
+	}
+
+	payload.Memo, err = renderMemo(transaction, config.Memos)
+	if err != nil {
+		log.Printf("Could not render memo: %v", err)
+	}
+
+	payees, err := getPayees(client, account.budgetID)
+	if isDeferred(err) {
+		return payload, err
+	}
+	if err != nil {
+		log.Printf("Could not retreive list of payees: %v", err)
+	} else {
+		payload.PayeeID, payload.PayeeName = applyPayee(transaction.Merchant, payees, config)
+	}
+
+	since := api.Date{Time: payload.Date.AddDate(0, 0, -config.Refunds.WindowDays)}
+	var recent []*ynabtransaction.Transaction
+	err = client.call("get refunded transaction", func() (err error) {
+		recent, err = client.Transaction().GetTransactionsByAccount(account.budgetID, account.account.ID, &ynabtransaction.Filter{Since: &since})
+		return
+	})
+	if isDeferred(err) {
+		return payload, err
+	}
+	if err != nil {
+		log.Printf("Could not look for the refunded purchase: %v", err)
+	}
+
+	if original := findRefundedTransaction(recent, payload, config.PayeeMatchThreshold); original != nil {
+		log.Printf("Refund %s reverses transaction %s", transaction.MessageID, original.ID)
+		linkRefund(&payload, original)
+		return payload, nil
+	}
+
+	categoryID, _, err := assignCategory(client, account.budgetID, transaction, config.CategoryRules)
+	if isDeferred(err) {
+		return payload, err
+	}
+	if err != nil {
+		notifyError("Could not assign category", err)
+	} else {
+		payload.CategoryID = categoryID
+	}
+	return payload, nil
+}
+
+// findRefundedTransaction looks for an outflow to the same payee at least as large as the
+// refund. A purchase with the exact amount wins over a partial refund, then the most recent.
+func findRefundedTransaction(transactions []*ynabtransaction.Transaction, payload ynabtransaction.PayloadTransaction, threshold float64) *ynabtransaction.Transaction {
+	var best *ynabtransaction.Transaction
+	bestExact := false
+	for _, existing := range transactions {
+		if existing.Deleted || existing.TransferAccountID != nil || existing.Amount >= 0 {
+			continue
+		}
+		if -existing.Amount < payload.Amount || existing.Date.After(payload.Date.Time) {
+			continue
+		}
+		if !samePayee(existing, payload, threshold) {
+			continue
+		}
+
+		exact := -existing.Amount == payload.Amount
+		if best == nil || (exact && !bestExact) || (exact == bestExact && existing.Date.After(best.Date.Time)) {
+			best, bestExact = existing, exact
+		}
+	}
+	return best
+}
+
+// linkRefund copies the purchase's category and notes its date in the memo
+func linkRefund(payload *ynabtransaction.PayloadTransaction, original *ynabtransaction.Transaction) {
+	// A split's category can't be assigned to a new transaction
+	if len(original.SubTransactions) == 0 {
+		payload.CategoryID = original.CategoryID
+	}
+
+	memo := "Refund of purchase on " + original.Date.Format("2006-01-02")
+	if payload.Memo != nil && *payload.Memo != "" {
+		memo += " | " + *payload.Memo
+	}
+	memo = truncate(memo, maxMemoLength)
+	payload.Memo = &memo
+}
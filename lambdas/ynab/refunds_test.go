@@ -0,0 +1,60 @@
+package main
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go.bmvs.io/ynab/api"
+	ynabtransaction "go.bmvs.io/ynab/api/transaction"
+)
+
+var _ = Describe("Refunds", func() {
+
+	var (
+		payload      ynabtransaction.PayloadTransaction
+		transactions []*ynabtransaction.Transaction
+	)
+
+	BeforeEach(func() {
+		date, _ := api.DateFromString("2020-10-20")
+		payee := "Shoe Store"
+		payload = ynabtransaction.PayloadTransaction{Date: date, Amount: 25000, PayeeName: &payee}
+
+		transactions = []*ynabtransaction.Transaction{
+			ynabTransaction("other", "2020-10-10", -25000, "Gas Station", ""),
+			ynabTransaction("larger", "2020-10-15", -80000, "Shoe Store", ""),
+			ynabTransaction("exact", "2020-10-01", -25000, "Shoe Store", ""),
+			ynabTransaction("smaller", "2020-10-16", -10000, "Shoe Store", ""),
+			ynabTransaction("inflow", "2020-10-17", 25000, "Shoe Store", ""),
+		}
+	})
+
+	Context("When a refund arrives, ", func() {
+
+		It("prefers the purchase with the same amount", func() {
+			original := findRefundedTransaction(transactions, payload, 0.8)
+			Expect(original).NotTo(BeNil())
+			Expect(original.ID).To(Equal("exact"))
+		})
+
+		It("falls back to a larger purchase for partial refunds", func() {
+			payload.Amount = 30000
+			original := findRefundedTransaction(transactions, payload, 0.8)
+			Expect(original).NotTo(BeNil())
+			Expect(original.ID).To(Equal("larger"))
+		})
+
+		It("finds nothing for a refund larger than any purchase", func() {
+			payload.Amount = 100000
+			Expect(findRefundedTransaction(transactions, payload, 0.8)).To(BeNil())
+		})
+
+		It("copies the category and notes the purchase date", func() {
+			memo := "Chase *1234"
+			payload.Memo = &memo
+			linkRefund(&payload, transactions[2])
+			Expect(*payload.CategoryID).To(Equal("exactcategory"))
+			Expect(*payload.Memo).To(Equal("Refund of purchase on 2020-10-01 | Chase *1234"))
+		})
+	})
+
+})
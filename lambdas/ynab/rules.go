@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ruleConditions are shared by every kind of rule in the config. A transaction matches
+// when it meets every condition that is set, conditions left empty match anything.
+type ruleConditions struct {
+	// Regular expression matched case insensitively against the raw merchant
+	Merchant  string   `json:"merchant"`
+	Cards     []int    `json:"cards"`
+	MinAmount *float64 `json:"minAmount"`
+	MaxAmount *float64 `json:"maxAmount"`
+	// Day names, e.g. "Saturday"
+	Weekdays []string `json:"weekdays"`
+	// Parser names from the email lambda, e.g. "Chase"
+	Parsers []string `json:"parsers"`
+
+	merchant *regexp.Regexp
+}
+
+// categoryRule assigns a category to transactions matching its conditions
+type categoryRule struct {
+	Name string `json:"name"`
+	ruleConditions
+	// Category name, optionally prefixed with its group: "Everyday Expenses: Groceries"
+	Category string `json:"category"`
+	// Transactions categorized by a high confidence rule may be approved automatically
+	HighConfidence bool `json:"highConfidence"`
+}
+
+// ruleMatch explains which rule fired and why
+type ruleMatch struct {
+	rule    *categoryRule
+	reasons []string
+}
+
+func (m ruleMatch) String() string {
+	reasons := strings.Join(m.reasons, ", ")
+	if reasons == "" {
+		reasons = "matches everything"
+	}
+	return fmt.Sprintf("rule %q (%s) -> %s", m.rule.Name, reasons, m.rule.Category)
+}
+
+// compileRules validates the rules once when the config is loaded
+func compileRules(rules []categoryRule) error {
+	for i := range rules {
+		rule := &rules[i]
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule %d", i+1)
+		}
+		if rule.Category == "" {
+			return fmt.Errorf("category rule %q has no category", rule.Name)
+		}
+		if err := rule.compile(); err != nil {
+			return fmt.Errorf("category rule %q %v", rule.Name, err)
+		}
+	}
+	return nil
+}
+
+func (r *ruleConditions) compile() error {
+	if r.Merchant != "" {
+		re, err := regexp.Compile("(?i)" + r.Merchant)
+		if err != nil {
+			return fmt.Errorf("has an invalid merchant pattern: %v", err)
+		}
+		r.merchant = re
+	}
+	for _, day := range r.Weekdays {
+		if _, ok := weekdays[strings.ToLower(day)]; !ok {
+			return fmt.Errorf("has an unknown weekday %q", day)
+		}
+	}
+	return nil
+}
+
+var weekdays = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
+
+// matchRule returns the first rule matching the transaction. Rules are evaluated in the
+// order they appear in the config file.
+func matchRule(rules []categoryRule, transaction Transaction) (ruleMatch, bool) {
+	for i := range rules {
+		if reasons, ok := rules[i].matches(transaction); ok {
+			return ruleMatch{rule: &rules[i], reasons: reasons}, true
+		}
+	}
+	return ruleMatch{}, false
+}
+
+func (r *ruleConditions) matches(transaction Transaction) ([]string, bool) {
+	var reasons []string
+
+	if r.merchant != nil {
+		if !r.merchant.MatchString(transaction.Merchant) {
+			return nil, false
+		}
+		reasons = append(reasons, fmt.Sprintf("merchant %q matches %q", transaction.Merchant, r.Merchant))
+	}
+
+	if len(r.Cards) > 0 {
+		found := false
+		for _, card := range r.Cards {
+			found = found || card == transaction.LastDigits
+		}
+		if !found {
+			return nil, false
+		}
+		reasons = append(reasons, fmt.Sprintf("card %d", transaction.LastDigits))
+	}
+
+	amount := float64(transaction.Amount)
+	if r.MinAmount != nil {
+		if amount < *r.MinAmount {
+			return nil, false
+		}
+		reasons = append(reasons, fmt.Sprintf("amount %.2f >= %.2f", amount, *r.MinAmount))
+	}
+	if r.MaxAmount != nil {
+		if amount > *r.MaxAmount {
+			return nil, false
+		}
+		reasons = append(reasons, fmt.Sprintf("amount %.2f <= %.2f", amount, *r.MaxAmount))
+	}
+
+	if len(r.Weekdays) > 0 {
+		date, err := time.Parse("2006-01-02", transaction.Date)
+		if err != nil {
+			return nil, false
+		}
+		found := false
+		for _, day := range r.Weekdays {
+			found = found || weekdays[strings.ToLower(day)] == date.Weekday()
+		}
+		if !found {
+			return nil, false
+		}
+		reasons = append(reasons, fmt.Sprintf("on a %s", date.Weekday()))
+	}
+
+	if len(r.Parsers) > 0 {
+		found := false
+		for _, parser := range r.Parsers {
+			found = found || strings.EqualFold(parser, transaction.Parser)
+		}
+		if !found {
+			return nil, false
+		}
+		reasons = append(reasons, fmt.Sprintf("parser %q", transaction.Parser))
+	}
+	return reasons, true
+}
+
+// assignCategory returns the category of the first matching rule and the rule that set it.
+// Both are nil when no rule matches.
+func assignCategory(client *ynabClient, budgetID string, transaction Transaction, rules []categoryRule) (*string, *categoryRule, error) {
+	match, ok := matchRule(rules, transaction)
+	if !ok {
+		return nil, nil, nil
+	}
+	log.Printf("Categorizing %s with %s", transaction.MessageID, match)
+
+	groups, err := getCategories(client, budgetID)
+	if err != nil {
+		return nil, nil, err
+	}
+	categoryID, err := findCategoryID(groups, match.rule.Category)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %v", match, err)
+	}
+	return &categoryID, match.rule, nil
+}
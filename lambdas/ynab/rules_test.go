@@ -0,0 +1,83 @@
+package main
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	ynabcategory "go.bmvs.io/ynab/api/category"
+)
+
+var _ = Describe("Category rules", func() {
+
+	var (
+		rules       []categoryRule
+		transaction Transaction
+		groups      []*ynabcategory.GroupWithCategories
+	)
+
+	BeforeEach(func() {
+		maxAmount := 20.0
+		rules = []categoryRule{
+			{Name: "weekend coffee", ruleConditions: ruleConditions{Merchant: "coffee|starbucks", MaxAmount: &maxAmount, Weekdays: []string{"Saturday", "Sunday"}}, Category: "Fun: Dining Out"},
+			{Name: "costco", ruleConditions: ruleConditions{Cards: []int{2345}, Parsers: []string{"Citi"}}, Category: "Groceries"},
+			{Name: "everything else", Category: "Misc"},
+		}
+		Expect(compileRules(rules)).To(Succeed())
+
+		transaction = Transaction{
+			MessageID:  "asdfasdfasdfasdf",
+			LastDigits: 1234,
+			Date:       "2020-10-17", // Saturday
+			Amount:     5.75,
+			Merchant:   "STARBUCKS STORE 01234",
+			Parser:     "Chase",
+		}
+
+		groups = []*ynabcategory.GroupWithCategories{
+			{Name: "Fun", Categories: []*ynabcategory.Category{{ID: "diningid", Name: "Dining Out"}}},
+			{Name: "Everyday", Categories: []*ynabcategory.Category{{ID: "groceriesid", Name: "Groceries"}, {ID: "miscid", Name: "Misc"}}},
+			{Name: "Business", Categories: []*ynabcategory.Category{{ID: "businessmiscid", Name: "Misc"}}},
+		}
+	})
+
+	Context("When matching rules, ", func() {
+
+		It("fires the first rule that matches every condition", func() {
+			match, ok := matchRule(rules, transaction)
+			Expect(ok).To(BeTrue())
+			Expect(match.rule.Name).To(Equal("weekend coffee"))
+			Expect(match.String()).To(ContainSubstring("on a Saturday"))
+		})
+
+		It("skips rules with a failing condition", func() {
+			transaction.Date = "2020-10-19" // Monday
+			match, _ := matchRule(rules, transaction)
+			Expect(match.rule.Name).To(Equal("everything else"))
+
+			transaction.LastDigits = 2345
+			transaction.Parser = "Citi"
+			match, _ = matchRule(rules, transaction)
+			Expect(match.rule.Name).To(Equal("costco"))
+		})
+
+		It("rejects invalid rules", func() {
+			Expect(compileRules([]categoryRule{{ruleConditions: ruleConditions{Merchant: "("}, Category: "Misc"}})).NotTo(Succeed())
+			Expect(compileRules([]categoryRule{{ruleConditions: ruleConditions{Weekdays: []string{"Caturday"}}, Category: "Misc"}})).NotTo(Succeed())
+		})
+	})
+
+	Context("When resolving category names, ", func() {
+
+		It("finds categories with or without their group", func() {
+			Expect(findCategoryID(groups, "dining out")).To(Equal("diningid"))
+			Expect(findCategoryID(groups, "Business: Misc")).To(Equal("businessmiscid"))
+		})
+
+		It("fails on ambiguous or unknown names", func() {
+			_, err := findCategoryID(groups, "Misc")
+			Expect(err).NotTo(BeNil())
+			_, err = findCategoryID(groups, "Travel")
+			Expect(err).NotTo(BeNil())
+		})
+	})
+
+})
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+
+	ynabbudget "go.bmvs.io/ynab/api/budget"
+	ynabtransaction "go.bmvs.io/ynab/api/transaction"
+)
+
+// sharedRule posts part of a matching transaction to a category tracking what another
+// person owes, e.g. half of every charge on a card shared with a roommate.
+type sharedRule struct {
+	Name string `json:"name"`
+	ruleConditions
+	// Who pays us back
+	Person string `json:"person"`
+	// Their share of the transaction, 50 when not set
+	Percent float64 `json:"percent"`
+	// Category the owed portion is posted to, e.g. "Reimbursements: Owed by Sam"
+	Category string `json:"category"`
+	// Payee on the owed portion, the person's name when not set
+	Payee string `json:"payee"`
+}
+
+func compileSharedRules(rules []sharedRule) error {
+	for i := range rules {
+		rule := &rules[i]
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("shared %d", i+1)
+		}
+		if rule.Person == "" || rule.Category == "" {
+			return fmt.Errorf("shared rule %q needs a person and a category", rule.Name)
+		}
+		if rule.Percent == 0 {
+			rule.Percent = 50
+		}
+		if rule.Percent < 0 || rule.Percent > 100 {
+			return fmt.Errorf("shared rule %q has a percent outside 0-100", rule.Name)
+		}
+		if rule.Payee == "" {
+			rule.Payee = rule.Person
+		}
+		if err := rule.compile(); err != nil {
+			return fmt.Errorf("shared rule %q %v", rule.Name, err)
+		}
+	}
+	return nil
+}
+
+func matchSharedRule(rules []sharedRule, transaction Transaction) *sharedRule {
+	for i := range rules {
+		if _, ok := rules[i].matches(transaction); ok {
+			return &rules[i]
+		}
+	}
+	return nil
+}
+
+// shareTransaction carves the owed portion out of the transaction. Our portion keeps the
+// category, or the categories of an existing split, scaled down to what is left. The rule
+// is only returned when the transaction was shared.
+func shareTransaction(client *ynabClient, budgetID string, transaction Transaction, payload ynabtransaction.PayloadTransaction, subtransactions []subTransaction, rules []sharedRule) ([]subTransaction, *sharedRule, error) {
+	rule := matchSharedRule(rules, transaction)
+	if rule == nil {
+		return subtransactions, nil, nil
+	}
+	log.Printf("Sharing %.0f%% of %s with %s", rule.Percent, transaction.MessageID, rule.Person)
+
+	groups, err := getCategories(client, budgetID)
+	if err != nil {
+		return subtransactions, nil, err
+	}
+	owedCategoryID, err := findCategoryID(groups, rule.Category)
+	if err != nil {
+		return subtransactions, nil, fmt.Errorf("shared rule %q: %v", rule.Name, err)
+	}
+
+	return shareAmounts(payload, subtransactions, rule, owedCategoryID), rule, nil
+}
+
+func shareAmounts(payload ynabtransaction.PayloadTransaction, subtransactions []subTransaction, rule *sharedRule, owedCategoryID string) []subTransaction {
+	percent := rule.Percent
+	amounts := splitAmounts(payload.Amount, []splitPart{{Percent: &percent}, {Remainder: true}})
+	owed, ours := amounts[0], amounts[1]
+
+	var shared []subTransaction
+	if len(subtransactions) == 0 {
+		if ours != 0 {
+			shared = append(shared, subTransaction{Amount: ours, CategoryID: payload.CategoryID})
+		}
+	} else {
+		// Keep each existing part's share of what is left
+		parts := make([]splitPart, len(subtransactions))
+		for i, sub := range subtransactions {
+			share := float64(sub.Amount) / float64(payload.Amount) * 100
+			parts[i] = splitPart{Percent: &share}
+		}
+		parts[len(parts)-1] = splitPart{Remainder: true}
+
+		scaled := splitAmounts(ours, parts)
+		for i, sub := range subtransactions {
+			if scaled[i] == 0 {
+				continue
+			}
+			sub.Amount = scaled[i]
+			shared = append(shared, sub)
+		}
+	}
+
+	payee := rule.Payee
+	memo := truncate("Owed by "+rule.Person, maxMemoLength)
+	return append(shared, subTransaction{Amount: owed, PayeeName: &payee, CategoryID: &owedCategoryID, Memo: &memo})
+}
+
+// sharedBalance adds up how much a person owes from the activity in their category.
+// Posted shares are outflows, reimbursements categorized the same way are inflows.
+func sharedBalance(client *ynabClient, budgetID string, rule *sharedRule) (int64, error) {
+	groups, err := getCategories(client, budgetID)
+	if err != nil {
+		return 0, err
+	}
+	categoryID, err := findCategoryID(groups, rule.Category)
+	if err != nil {
+		return 0, err
+	}
+
+	var transactions []*ynabtransaction.Hybrid
+	err = client.call("get shared transactions", func() (err error) {
+		transactions, err = client.Transaction().GetTransactionsByCategory(budgetID, categoryID, nil)
+		return
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var balance int64
+	for _, transaction := range transactions {
+		if !transaction.Deleted {
+			balance -= transaction.Amount
+		}
+	}
+	return balance, nil
+}
+
+// sharedBalances reports every person's balance across all budgets
+func sharedBalances(client *ynabClient, budgets []*ynabbudget.Summary, rules []sharedRule) (map[string]int64, error) {
+	balances := map[string]int64{}
+	for _, budget := range budgets {
+		seen := map[string]bool{}
+		for i := range rules {
+			rule := &rules[i]
+			if seen[rule.Category] {
+				continue
+			}
+			seen[rule.Category] = true
+
+			balance, err := sharedBalance(client, budget.ID, rule)
+			if isDeferred(err) {
+				return nil, err
+			}
+			if err != nil {
+				// Not every budget tracks every person
+				log.Printf("Skipping %s in budget %s: %v", rule.Person, budget.Name, err)
+				continue
+			}
+			balances[rule.Person] += balance
+		}
+	}
+	return balances, nil
+}
+
+// formatBalances lists what each person owes, one per line
+func formatBalances(balances map[string]int64) string {
+	people := make([]string, 0, len(balances))
+	for person := range balances {
+		people = append(people, person)
+	}
+	sort.Strings(people)
+
+	report := ""
+	for _, person := range people {
+		report += fmt.Sprintf("%s owes $%.2f\n", person, float64(balances[person])/1000)
+	}
+	return report
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	ynabtransaction "go.bmvs.io/ynab/api/transaction"
+)
+
+var _ = Describe("Shared expenses", func() {
+
+	var (
+		rules   []sharedRule
+		payload ynabtransaction.PayloadTransaction
+	)
+
+	BeforeEach(func() {
+		rules = []sharedRule{
+			{Name: "utilities", ruleConditions: ruleConditions{Merchant: "pg&e"}, Person: "Sam", Category: "Owed by Sam"},
+		}
+		Expect(compileSharedRules(rules)).To(Succeed())
+
+		groceries := "groceriesid"
+		payload = ynabtransaction.PayloadTransaction{Amount: -100010, CategoryID: &groceries}
+	})
+
+	Context("When sharing a transaction, ", func() {
+
+		It("defaults to half and the person as payee", func() {
+			Expect(rules[0].Percent).To(Equal(50.0))
+			Expect(rules[0].Payee).To(Equal("Sam"))
+			Expect(matchSharedRule(rules, Transaction{Merchant: "PG&E WEB ONLINE"})).To(Equal(&rules[0]))
+		})
+
+		It("splits our portion from the owed portion", func() {
+			subtransactions := shareAmounts(payload, nil, &rules[0], "owedid")
+			Expect(subtransactions).To(HaveLen(2))
+			Expect(subtransactions[0].Amount).To(Equal(int64(-50000)))
+			Expect(*subtransactions[0].CategoryID).To(Equal("groceriesid"))
+			Expect(subtransactions[1].Amount).To(Equal(int64(-50010)))
+			Expect(*subtransactions[1].CategoryID).To(Equal("owedid"))
+			Expect(*subtransactions[1].PayeeName).To(Equal("Sam"))
+		})
+
+		It("scales an existing split down to our portion", func() {
+			groceries, household := "groceriesid", "householdid"
+			payload.Amount = -100000
+			existing := []subTransaction{
+				{Amount: -70000, CategoryID: &groceries},
+				{Amount: -30000, CategoryID: &household},
+			}
+			subtransactions := shareAmounts(payload, existing, &rules[0], "owedid")
+			Expect(subtransactions).To(HaveLen(3))
+			Expect(subtransactions[0].Amount).To(Equal(int64(-35000)))
+			Expect(subtransactions[1].Amount).To(Equal(int64(-15000)))
+			Expect(subtransactions[2].Amount).To(Equal(int64(-50000)))
+		})
+
+		It("posts a full share as the person's transaction", func() {
+			rules[0].Percent = 100
+			merchant, memo := "PG&E", "Utilities"
+			payload.PayeeName, payload.Memo = &merchant, &memo
+			subtransactions := collapseSplit(&payload, shareAmounts(payload, nil, &rules[0], "owedid"))
+			Expect(subtransactions).To(BeNil())
+			Expect(payload.Amount).To(Equal(int64(-100010)))
+			Expect(*payload.CategoryID).To(Equal("owedid"))
+			Expect(*payload.PayeeName).To(Equal("Sam"))
+			Expect(*payload.Memo).To(Equal("Owed by Sam"))
+		})
+	})
+
+	Context("When reporting balances, ", func() {
+
+		It("lists each person", func() {
+			Expect(formatBalances(map[string]int64{"Sam": 123450, "Alex": 5000})).To(Equal("Alex owes $5.00\nSam owes $123.45\n"))
+		})
+	})
+
+})
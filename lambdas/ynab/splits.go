@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+
+	ynabtransaction "go.bmvs.io/ynab/api/transaction"
+)
+
+// splitRule splits matching transactions across several categories
+type splitRule struct {
+	Name string `json:"name"`
+	ruleConditions
+	Parts []splitPart `json:"parts"`
+}
+
+// splitPart is one subtransaction of a split. Fixed amounts are taken first, then
+// percentages of the whole, and the remainder part gets whatever is left.
+type splitPart struct {
+	Category  string   `json:"category"`
+	Percent   *float64 `json:"percent"`
+	Amount    *float64 `json:"amount"`
+	Remainder bool     `json:"remainder"`
+	Memo      string   `json:"memo"`
+}
+
+// subTransaction is a YNAB subtransaction. The ynab package can't create them.
+type subTransaction struct {
+	Amount     int64   `json:"amount"`
+	PayeeID    *string `json:"payee_id,omitempty"`
+	PayeeName  *string `json:"payee_name,omitempty"`
+	CategoryID *string `json:"category_id"`
+	Memo       *string `json:"memo,omitempty"`
+}
+
+type splitPayload struct {
+	ynabtransaction.PayloadTransaction
+	SubTransactions []subTransaction `json:"subtransactions"`
+}
+
+func compileSplitRules(rules []splitRule) error {
+	for i := range rules {
+		rule := &rules[i]
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("split %d", i+1)
+		}
+		if err := rule.compile(); err != nil {
+			return fmt.Errorf("split rule %q %v", rule.Name, err)
+		}
+		if err := validateParts(rule.Parts); err != nil {
+			return fmt.Errorf("split rule %q %v", rule.Name, err)
+		}
+	}
+	return nil
+}
+
+func validateParts(parts []splitPart) error {
+	if len(parts) < 2 {
+		return fmt.Errorf("needs at least two parts")
+	}
+
+	remainders := 0
+	percent := 0.0
+	for _, part := range parts {
+		if part.Category == "" {
+			return fmt.Errorf("has a part without a category")
+		}
+		set := 0
+		if part.Percent != nil {
+			set++
+			percent += *part.Percent
+		}
+		if part.Amount != nil {
+			set++
+		}
+		if part.Remainder {
+			set++
+			remainders++
+		}
+		if set != 1 {
+			return fmt.Errorf("parts need exactly one of percent, amount or remainder")
+		}
+	}
+
+	if remainders > 1 {
+		return fmt.Errorf("can only have one remainder part")
+	}
+	if percent > 100 {
+		return fmt.Errorf("percentages add up to more than 100")
+	}
+	if remainders == 0 && math.Abs(percent-100) > 0.001 {
+		return fmt.Errorf("needs a remainder part or percentages adding up to 100")
+	}
+	return nil
+}
+
+// splitAmounts divides a milliunit amount between the parts in whole cents. Rounding
+// differences go to the remainder part, or the last part when there is none, so the
+// subtransactions always add up to the parent exactly.
+func splitAmounts(amount int64, parts []splitPart) []int64 {
+	sign := int64(1)
+	if amount < 0 {
+		sign = -1
+	}
+	total := sign * amount
+
+	amounts := make([]int64, len(parts))
+	remainder := len(parts) - 1
+	left := total
+	take := func(i int, amount int64) {
+		if amount > left {
+			// A part can't take more than what is left of the charge
+			amount = left
+		}
+		amounts[i] = amount
+		left -= amount
+	}
+
+	// Fixed amounts first, wherever they are in the rule
+	for i, part := range parts {
+		if part.Remainder {
+			remainder = i
+		} else if part.Amount != nil {
+			take(i, int64(math.Round(*part.Amount*100))*10)
+		}
+	}
+	for i, part := range parts {
+		if !part.Remainder && part.Amount == nil && part.Percent != nil {
+			cents := float64(total) / 10
+			take(i, int64(math.Round(cents*(*part.Percent)/100))*10)
+		}
+	}
+	amounts[remainder] += left
+
+	for i := range amounts {
+		amounts[i] *= sign
+	}
+	return amounts
+}
+
+// splitTransaction returns the subtransactions for the first matching split rule, or nil
+func splitTransaction(client *ynabClient, budgetID string, transaction Transaction, payload ynabtransaction.PayloadTransaction, rules []splitRule) ([]subTransaction, error) {
+	for i := range rules {
+		rule := &rules[i]
+		if _, ok := rule.matches(transaction); !ok {
+			continue
+		}
+		log.Printf("Splitting %s with %s", transaction.MessageID, rule.Name)
+
+		groups, err := getCategories(client, budgetID)
+		if err != nil {
+			return nil, err
+		}
+
+		amounts := splitAmounts(payload.Amount, rule.Parts)
+		subtransactions := make([]subTransaction, 0, len(rule.Parts))
+		for j, part := range rule.Parts {
+			if amounts[j] == 0 {
+				continue
+			}
+			categoryID, err := findCategoryID(groups, part.Category)
+			if err != nil {
+				return nil, fmt.Errorf("split rule %q: %v", rule.Name, err)
+			}
+			sub := subTransaction{Amount: amounts[j], CategoryID: &categoryID}
+			if part.Memo != "" {
+				memo := truncate(part.Memo, maxMemoLength)
+				sub.Memo = &memo
+			}
+			subtransactions = append(subtransactions, sub)
+		}
+
+		if len(subtransactions) < 2 {
+			// Everything landed in one part, post it as a normal transaction
+			return nil, nil
+		}
+		return subtransactions, nil
+	}
+	return nil, nil
+}
+
+// createSplitTransaction posts a transaction with subtransactions straight to the YNAB API
+func createSplitTransaction(client *ynabClient, budgetID string, payload ynabtransaction.PayloadTransaction, subtransactions []subTransaction) error {
+	body := struct {
+		Transaction splitPayload `json:"transaction"`
+	}{
+		Transaction: splitPayload{PayloadTransaction: payload, SubTransactions: subtransactions},
+	}
+	return client.do("POST", fmt.Sprintf("/budgets/%s/transactions", budgetID), body, nil)
+}
+
+// updateSplitTransaction turns an existing transaction into a split. YNAB can't change the
+// subtransactions of a transaction that is already split.
+func updateSplitTransaction(client *ynabClient, budgetID, transactionID string, payload ynabtransaction.PayloadTransaction, subtransactions []subTransaction) error {
+	body := struct {
+		Transaction splitPayload `json:"transaction"`
+	}{
+		Transaction: splitPayload{PayloadTransaction: payload, SubTransactions: subtransactions},
+	}
+	return client.do("PUT", fmt.Sprintf("/budgets/%s/transactions/%s", budgetID, transactionID), body, nil)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Split transactions", func() {
+
+	percent := func(p float64) *float64 { return &p }
+	amount := func(a float64) *float64 { return &a }
+	sum := func(amounts []int64) (total int64) {
+		for _, a := range amounts {
+			total += a
+		}
+		return
+	}
+
+	Context("When dividing an amount, ", func() {
+
+		It("gives rounding differences to the remainder", func() {
+			parts := []splitPart{
+				{Category: "Groceries", Percent: percent(33.33)},
+				{Category: "Household", Remainder: true},
+				{Category: "Pharmacy", Percent: percent(33.33)},
+			}
+			amounts := splitAmounts(-100010, parts)
+			Expect(amounts).To(Equal([]int64{-33330, -33350, -33330}))
+			Expect(sum(amounts)).To(Equal(int64(-100010)))
+		})
+
+		It("gives rounding differences to the last part without a remainder", func() {
+			parts := []splitPart{
+				{Category: "Groceries", Percent: percent(33.33)},
+				{Category: "Household", Percent: percent(33.33)},
+				{Category: "Pharmacy", Percent: percent(33.34)},
+			}
+			amounts := splitAmounts(-10000, parts)
+			Expect(amounts).To(Equal([]int64{-3330, -3330, -3340}))
+		})
+
+		It("takes fixed amounts first and never more than the charge", func() {
+			parts := []splitPart{
+				{Category: "Gas", Amount: amount(50)},
+				{Category: "Groceries", Remainder: true},
+			}
+			Expect(splitAmounts(-120000, parts)).To(Equal([]int64{-50000, -70000}))
+			Expect(splitAmounts(-30000, parts)).To(Equal([]int64{-30000, 0}))
+		})
+
+		It("takes fixed amounts before percentages listed ahead of them", func() {
+			parts := []splitPart{
+				{Category: "Groceries", Percent: percent(80)},
+				{Category: "Gas", Amount: amount(50)},
+				{Category: "Household", Remainder: true},
+			}
+			Expect(splitAmounts(-100000, parts)).To(Equal([]int64{-50000, -50000, 0}))
+			Expect(splitAmounts(-200000, parts)).To(Equal([]int64{-150000, -50000, 0}))
+			Expect(splitAmounts(-300000, parts)).To(Equal([]int64{-240000, -50000, -10000}))
+		})
+	})
+
+	Context("When validating split rules, ", func() {
+
+		It("accepts percentages with a remainder", func() {
+			Expect(validateParts([]splitPart{
+				{Category: "Groceries", Percent: percent(70)},
+				{Category: "Household", Remainder: true},
+			})).To(Succeed())
+		})
+
+		It("rejects incomplete or ambiguous parts", func() {
+			Expect(validateParts([]splitPart{{Category: "Groceries", Remainder: true}})).NotTo(Succeed())
+			Expect(validateParts([]splitPart{
+				{Category: "Groceries", Percent: percent(70)},
+				{Category: "Household", Percent: percent(20)},
+			})).NotTo(Succeed())
+			Expect(validateParts([]splitPart{
+				{Category: "Groceries", Percent: percent(70), Remainder: true},
+				{Category: "Household", Remainder: true},
+			})).NotTo(Succeed())
+		})
+	})
+
+})
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"regexp"
+)
+
+// Card descriptors of charges paid through PayPal or Venmo, e.g. "PAYPAL *STEAMGAMES"
+var walletDescriptor = regexp.MustCompile(`^(?i)(paypal|venmo)\s?\*`)
+
+// walletConfig controls transactions from PayPal and Venmo receipts
+type walletConfig struct {
+	// YNAB account for payments from each wallet's balance, the wallet name when not set
+	Accounts map[string]string `json:"accounts"`
+	// Drop card alerts for PayPal and Venmo charges. The receipt posts them with the real payee.
+	SkipCardAlerts bool `json:"skipCardAlerts"`
+}
+
+// getTransactionAccount finds the account by the digits in the alert, or the wallet's own
+// account when it was paid from a PayPal or Venmo balance.
+func getTransactionAccount(accounts []budgetAccount, transaction Transaction, wallets walletConfig) (budgetAccount, error) {
+	if transaction.Wallet == "" {
+		return getAccountID(accounts, transaction.LastDigits)
+	}
+	name, ok := wallets.Accounts[transaction.Wallet]
+	if !ok {
+		name = transaction.Wallet
+	}
+	return findAccountByName(accounts, "", name)
+}
+
+// isWalletCardAlert is true for a card alert the PayPal or Venmo receipt will post instead
+func isWalletCardAlert(transaction Transaction, wallets walletConfig) bool {
+	return wallets.SkipCardAlerts && transaction.Wallet == "" && walletDescriptor.MatchString(transaction.Merchant)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	ynabaccount "go.bmvs.io/ynab/api/account"
+)
+
+var _ = Describe("PayPal and Venmo", func() {
+
+	var (
+		wallets  walletConfig
+		accounts []budgetAccount
+	)
+
+	BeforeEach(func() {
+		card := "1234"
+		wallets = walletConfig{Accounts: map[string]string{"Venmo": "Venmo Balance"}, SkipCardAlerts: true}
+		accounts = []budgetAccount{
+			{budgetID: "budget", account: &ynabaccount.Account{ID: "card", Name: "Sapphire", Note: &card}},
+			{budgetID: "budget", account: &ynabaccount.Account{ID: "paypal", Name: "PayPal"}},
+			{budgetID: "budget", account: &ynabaccount.Account{ID: "venmo", Name: "Venmo Balance"}},
+		}
+	})
+
+	It("posts balance payments to the wallet's account", func() {
+		account, err := getTransactionAccount(accounts, Transaction{Wallet: "Venmo"}, wallets)
+		Expect(err).To(BeNil())
+		Expect(account.account.ID).To(Equal("venmo"))
+
+		account, err = getTransactionAccount(accounts, Transaction{Wallet: "PayPal"}, wallets)
+		Expect(err).To(BeNil())
+		Expect(account.account.ID).To(Equal("paypal"))
+	})
+
+	It("posts card payments to the card's account", func() {
+		account, err := getTransactionAccount(accounts, Transaction{LastDigits: 1234}, wallets)
+		Expect(err).To(BeNil())
+		Expect(account.account.ID).To(Equal("card"))
+	})
+
+	It("skips card alerts for PayPal and Venmo charges when asked", func() {
+		Expect(isWalletCardAlert(Transaction{Merchant: "PAYPAL *STEAMGAMES"}, wallets)).To(BeTrue())
+		Expect(isWalletCardAlert(Transaction{Merchant: "Venmo* John Smith"}, wallets)).To(BeTrue())
+		Expect(isWalletCardAlert(Transaction{Merchant: "Valve Corporation"}, wallets)).To(BeFalse())
+
+		wallets.SkipCardAlerts = false
+		Expect(isWalletCardAlert(Transaction{Merchant: "PAYPAL *STEAMGAMES"}, wallets)).To(BeFalse())
+	})
+
+})
@@ -13,4 +13,10 @@ resource "aws_dynamodb_table" "dynamodb-table" {
     type = "S"
   }
 
+  // Order confirmations nobody matched expire
+  ttl {
+    attribute_name = "ExpiresAt"
+    enabled        = true
+  }
+
 }
\ No newline at end of file
@@ -56,6 +56,7 @@ resource "aws_iam_policy" "gets3objects" {
     {
       "Action": [
         "s3:GetObject",
+        "s3:PutObject",
         "s3:DeleteObject"
       ],
       "Effect": "Allow",
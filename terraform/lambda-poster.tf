@@ -1,6 +1,7 @@
+// Binary plus the optional config.json
 data "archive_file" "ynab" {
   type        = "zip"
-  source_file = "../bin/ynab"
+  source_dir  = "../bin/ynab_package"
   output_path = "../bin/ynab.zip"
 }
 
@@ -12,7 +13,7 @@ resource "aws_lambda_function" "poster" {
   role             = aws_iam_role.ynab_poster.arn
   runtime          = "go1.x"
   memory_size      = 128
-  timeout          = 10
+  timeout          = 60 // Room to back off when YNAB rate limits us
   environment {
     variables = {
       BUCKET_NAME = aws_s3_bucket.bucket.bucket
@@ -74,7 +75,9 @@ resource "aws_iam_policy" "updateDynamo" {
     {
       "Action": [
         "dynamodb:DeleteItem",
-        "dynamodb:GetItem"
+        "dynamodb:UpdateItem",
+        "dynamodb:GetItem",
+        "dynamodb:Scan"
       ],
       "Effect": "Allow",
       "Resource": "${aws_dynamodb_table.dynamodb-table.arn}"
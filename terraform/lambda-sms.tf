@@ -0,0 +1,51 @@
+// Same binary as the email parser, receiving Twilio SMS webhooks.
+// The function URL or HTTP API calling it is created by hand, the pinned provider doesn't support them.
+resource "aws_lambda_function" "sms" {
+  function_name    = "ynab-sms-parser"
+  filename         = data.archive_file.email.output_path
+  handler          = "email" // For go, this is the name of the file.
+  source_code_hash = data.archive_file.email.output_base64sha256
+  role             = aws_iam_role.sms_parser.arn
+  runtime          = "go1.x"
+  memory_size      = 128
+  timeout          = 10
+  environment {
+    variables = {
+      LAMBDA_MODE = "sms"
+      TABLE_NAME = aws_dynamodb_table.dynamodb-table.name
+      SLACK_URL = var.slack_url
+      TWILIO_AUTH_TOKEN = var.twilio_auth_token
+    }
+  }
+}
+
+// Only needs to put transactions, it never reads mail
+resource "aws_iam_role" "sms_parser" {
+  name = "ynab_sms_parser_role"
+
+  assume_role_policy = <<EOF
+{
+  "Version": "2012-10-17",
+  "Statement": [
+    {
+      "Action": "sts:AssumeRole",
+      "Principal": {
+        "Service": "lambda.amazonaws.com"
+      },
+      "Effect": "Allow",
+      "Sid": ""
+    }
+  ]
+}
+EOF
+}
+
+resource "aws_iam_role_policy_attachment" "sms-policy-attachment-dynamo" {
+  role       = aws_iam_role.sms_parser.name
+  policy_arn = aws_iam_policy.putDynamo.arn
+}
+
+resource "aws_iam_role_policy_attachment" "sms-policy-executionrole" {
+  role       = aws_iam_role.sms_parser.name
+  policy_arn = "arn:aws:iam::aws:policy/service-role/AWSLambdaBasicExecutionRole"
+}
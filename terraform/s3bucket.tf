@@ -2,6 +2,8 @@ resource "aws_s3_bucket" "bucket" {
   bucket = var.s3_bucket_name
   acl    = "private"
 
+  // Everything expires: emails the poster kept after a failure, the quarantine, and
+  // receipts that wait in DynamoDB for their charge, which don't need the email anymore
   lifecycle_rule {
     enabled = true
 
@@ -14,4 +14,8 @@ variable domain_name {
 variable slack_url {
   type = string
   description = "Slack webhook url for notifications"
-}
\ No newline at end of file
+}
+variable twilio_auth_token {
+  type = string
+  description = "Twilio auth token for verifying SMS webhooks"
+}